@@ -0,0 +1,27 @@
+//go:build conformance
+
+package acmeproxy
+
+import (
+	acmetest "github.com/cert-manager/cert-manager/test/acme"
+	"testing"
+	"time"
+)
+
+// TestConformance runs cert-manager's DNS01 webhook conformance suite.
+// It needs etcd, kube-apiserver and kubectl, set TEST_ASSET_ETCD, TEST_ASSET_KUBE_APISERVER and TEST_ASSET_KUBECTL
+// or put them in PATH, and run with -tags conformance.
+func TestConformance(t *testing.T) {
+	h := newHarness(t)
+	fixture := acmetest.NewFixture(&Solver{},
+		acmetest.SetResolvedZone(testZone+"."),
+		acmetest.SetAllowAmbientCredentials(false),
+		acmetest.SetConfig(h.config()),
+		acmetest.SetDNSServer(h.dnsServer),
+		acmetest.SetUseAuthoritative(false),
+		acmetest.SetStrict(true),
+		acmetest.SetPollInterval(100*time.Millisecond),
+		acmetest.SetPropagationLimit(5*time.Second),
+	)
+	fixture.RunConformance(t)
+}
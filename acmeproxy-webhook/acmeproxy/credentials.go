@@ -0,0 +1,66 @@
+package acmeproxy
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CredentialsSecretRef refers to a secret holding all credentials.
+// If Key is empty, the secret must be a kubernetes.io/basic-auth secret with username and password,
+// otherwise Key holds a connection json, see connection.
+type CredentialsSecretRef struct {
+	SecretReference `json:",inline"`
+	Key             string `json:"key"`
+}
+
+// connection is the json stored in CredentialsSecretRef.Key
+type connection struct {
+	Server string `json:"server"`
+	User   string `json:"user"`
+	Token  string `json:"token"`
+	// CA is a PEM encoded CA bundle
+	CA string `json:"ca"`
+}
+
+// loadCredentials fills fields of cfg which are not set yet from CredentialsSecretRef.
+func (c *Solver) loadCredentials(cfg *DNSProviderConfig, resourceNamespace string) error {
+	ref := cfg.CredentialsSecretRef
+	secret, err := c.getSecret(ref.SecretReference, resourceNamespace)
+	if err != nil {
+		return errors.Wrap(err, "could not load credentials")
+	}
+	name := secret.Namespace + "/" + secret.Name
+
+	var conn connection
+	if ref.Key == "" {
+		if secret.Type != corev1.SecretTypeBasicAuth {
+			return errors.Errorf("credentials secret %q must be of type %q, or set key to read a connection json",
+				name, corev1.SecretTypeBasicAuth)
+		}
+		conn.User = string(secret.Data[corev1.BasicAuthUsernameKey])
+		conn.Token = string(secret.Data[corev1.BasicAuthPasswordKey])
+	} else {
+		data, ok := secret.Data[ref.Key]
+		if !ok {
+			return errors.Errorf("no key %q in secret %q", ref.Key, name)
+		}
+		if err := json.Unmarshal(data, &conn); err != nil {
+			return errors.Wrapf(err, "could not unmarshal connection json in key %q of secret %q", ref.Key, name)
+		}
+	}
+
+	if cfg.Server == "" {
+		cfg.Server = conn.Server
+	}
+	if cfg.User == "" {
+		cfg.User = conn.User
+	}
+	if cfg.Token == "" {
+		cfg.Token = conn.Token
+	}
+	if len(cfg.CABundle) == 0 && cfg.CASecretRef == nil {
+		cfg.CABundle = []byte(conn.CA)
+	}
+	return nil
+}
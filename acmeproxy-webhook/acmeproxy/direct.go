@@ -0,0 +1,163 @@
+package acmeproxy
+
+import (
+	"acmeproxy/dns"
+	"acmeproxy/proxy"
+	"context"
+	"fmt"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"strings"
+)
+
+// DirectConfigPathEnv is the environment variable holding the path of an acmeproxy config,
+// the direct solver is only registered if it is set
+const DirectConfigPathEnv = "DIRECT_CONFIG_PATH"
+
+// DirectSolver runs the providers of an acmeproxy config inside the webhook,
+// authorizing user and token of the solver config against its users and zones.
+// Solver may be shared with the acmeproxy solver, so both use the same secret cache.
+type DirectSolver struct {
+	*Solver
+
+	// ConfigPath is the acmeproxy config, usually mounted from a Secret
+	ConfigPath string
+
+	server *proxy.Server
+}
+
+func (d *DirectSolver) Name() string {
+	return "acmeproxy-direct"
+}
+
+func (d *DirectSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	err := d.Solver.Initialize(kubeClientConfig, stopCh)
+	if err != nil {
+		return err
+	}
+
+	return d.loadServer(stopCh)
+}
+
+// loadServer creates the server of the acmeproxy config, which is closed once stopCh is closed.
+func (d *DirectSolver) loadServer(stopCh <-chan struct{}) error {
+	config, err := proxy.LoadConfig(d.ConfigPath)
+	if err != nil {
+		return err
+	}
+	if err := validateDirectConfig(config); err != nil {
+		return errors.Wrapf(err, "invalid config %q", d.ConfigPath)
+	}
+	d.server, err = config.NewServer()
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-stopCh
+		d.server.Close()
+	}()
+	return nil
+}
+
+// validateDirectConfig rejects features of acmeproxy which answer DNS or HTTP requests on their own listeners,
+// the direct solver only calls providers, so nothing would serve them.
+func validateDirectConfig(config *proxy.Config) error {
+	var unsupported []string
+	for _, spec := range config.Providers {
+		if spec.Provider == dns.AuthoritativeProviderName {
+			unsupported = append(unsupported, fmt.Sprintf("provider %q of zone %q", spec.Provider, spec.Zone))
+		}
+	}
+	if config.AcmeDNS.Enabled {
+		unsupported = append(unsupported, "acmeDNS")
+	}
+	if config.RFC2136.Enabled {
+		unsupported = append(unsupported, "rfc2136")
+	}
+	if len(unsupported) > 0 {
+		return errors.Errorf("%s not supported by the direct solver, which does not start the listeners of acmeproxy, "+
+			"run acmeproxy and use the acmeproxy solver instead", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+func (d *DirectSolver) Present(ch *v1alpha1.ChallengeRequest) error {
+	user, err := d.authenticate(ch, actionPresent)
+	if err != nil {
+		return err
+	}
+	_, err = d.server.PresentRecord(context.Background(), user, ch.ResolvedFQDN, ch.Key)
+	err = directError(err)
+	d.events.result(ch, actionPresent, err)
+	return err
+}
+
+func (d *DirectSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
+	user, err := d.authenticate(ch, actionCleanup)
+	if err != nil {
+		return err
+	}
+	_, err = d.server.CleanUpRecord(context.Background(), user, ch.ResolvedFQDN, ch.Key)
+	if errors.Is(err, proxy.ErrRecordNotFound) {
+		// already cleaned up, cert-manager may call CleanUp more than once
+		err = nil
+	}
+	err = directError(err)
+	d.events.result(ch, actionCleanup, err)
+	return err
+}
+
+// authenticate loads user and token of the solver config and checks them against the acmeproxy config.
+func (d *DirectSolver) authenticate(ch *v1alpha1.ChallengeRequest, action string) (string, error) {
+	config, err := d.loadConfig(ch)
+	if err == nil {
+		err = config.validateDirect()
+	}
+	if err != nil {
+		d.events.event(ch, corev1.EventTypeWarning, ReasonInvalidConfig, "%s", err)
+		return "", err
+	}
+
+	if !d.server.Authenticate(config.User, config.Token) {
+		err := &apiError{Status: http.StatusUnauthorized, Code: string(proxy.ErrUnauthorized), Message: "invalid user or token"}
+		d.events.result(ch, action, err)
+		return "", err
+	}
+	return config.User, nil
+}
+
+// validateDirect checks the config of the direct solver once secrets are loaded.
+func (cfg *DNSProviderConfig) validateDirect() error {
+	var errs field.ErrorList
+	if cfg.Server != "" || len(cfg.Servers) > 0 {
+		errs = append(errs, field.Forbidden(field.NewPath("server"), "the direct solver does not use a server, remove it or use the acmeproxy solver"))
+	}
+	if cfg.User == "" {
+		errs = append(errs, field.Required(field.NewPath("user"), "set user, userSecretRef or credentialsSecretRef"))
+	}
+	if cfg.Token == "" {
+		errs = append(errs, field.Required(field.NewPath("token"), "set token, tokenSecretRef or credentialsSecretRef"))
+	}
+	if len(errs) > 0 {
+		return errors.Wrap(errs.ToAggregate(), "invalid solver config")
+	}
+	return nil
+}
+
+// directError converts errors of the proxy into apiError, so they are reported like the proxy api does.
+func directError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, proxy.ErrDomainNotAllowed):
+		return &apiError{Status: http.StatusForbidden, Code: string(proxy.ErrForbiddenZone), Message: err.Error()}
+	case errors.Is(err, proxy.ErrCNAME):
+		return &apiError{Status: http.StatusBadGateway, Code: string(proxy.ErrResolve), Message: err.Error()}
+	default:
+		return &apiError{Status: http.StatusBadGateway, Code: string(proxy.ErrProvider), Message: err.Error()}
+	}
+}
@@ -0,0 +1,118 @@
+package acmeproxy
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SelectionFailover   = "failover"
+	SelectionRoundRobin = "roundRobin"
+)
+
+const (
+	// unhealthyCooldown is how long a failed server is tried last
+	unhealthyCooldown = 30 * time.Second
+	// presentedTTL is how long the server which handled a present is remembered for cleanup
+	presentedTTL = 24 * time.Hour
+)
+
+// endpointTracker remembers server health and which server presented a challenge, shared by all clients.
+type endpointTracker struct {
+	mu             sync.Mutex
+	unhealthyUntil map[string]time.Time
+	counters       map[string]int
+	presented      map[string]presentedBy
+}
+
+type presentedBy struct {
+	server string
+	at     time.Time
+}
+
+func newEndpointTracker() *endpointTracker {
+	return &endpointTracker{
+		unhealthyUntil: make(map[string]time.Time),
+		counters:       make(map[string]int),
+		presented:      make(map[string]presentedBy),
+	}
+}
+
+// order returns servers in the order they should be tried.
+// preferred, if one of servers, goes first, unhealthy servers go last.
+func (t *endpointTracker) order(servers []*url.URL, selection string, preferred string) []*url.URL {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ordered := slices.Clone(servers)
+	if selection == SelectionRoundRobin && len(ordered) > 1 {
+		key := serversKey(servers)
+		start := t.counters[key] % len(ordered)
+		t.counters[key]++
+		ordered = slices.Concat(ordered[start:], ordered[:start])
+	}
+
+	now := time.Now()
+	rank := func(u *url.URL) int {
+		switch {
+		case u.String() == preferred:
+			return 0
+		case now.Before(t.unhealthyUntil[u.String()]):
+			return 2
+		default:
+			return 1
+		}
+	}
+	slices.SortStableFunc(ordered, func(a, b *url.URL) int {
+		return rank(a) - rank(b)
+	})
+	return ordered
+}
+
+func (t *endpointTracker) markHealthy(server string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.unhealthyUntil, server)
+}
+
+func (t *endpointTracker) markUnhealthy(server string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unhealthyUntil[server] = time.Now().Add(unhealthyCooldown)
+}
+
+func (t *endpointTracker) rememberPresent(fqdn, key, server string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for k, p := range t.presented {
+		if now.Sub(p.at) > presentedTTL {
+			delete(t.presented, k)
+		}
+	}
+	t.presented[fqdn+"/"+key] = presentedBy{server: server, at: now}
+}
+
+// presentedBy returns the server which presented the challenge, or an empty string if unknown.
+func (t *endpointTracker) presentedBy(fqdn, key string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.presented[fqdn+"/"+key].server
+}
+
+func (t *endpointTracker) forgetPresent(fqdn, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.presented, fqdn+"/"+key)
+}
+
+func serversKey(servers []*url.URL) string {
+	var keys []string
+	for _, u := range servers {
+		keys = append(keys, u.String())
+	}
+	return strings.Join(keys, ",")
+}
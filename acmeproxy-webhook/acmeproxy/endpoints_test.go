@@ -0,0 +1,97 @@
+package acmeproxy
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func parseServers(t *testing.T, servers ...string) []*url.URL {
+	t.Helper()
+	var urls []*url.URL
+	for _, server := range servers {
+		u, err := url.Parse(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func orderOf(urls []*url.URL) []string {
+	var servers []string
+	for _, u := range urls {
+		servers = append(servers, u.String())
+	}
+	return servers
+}
+
+func TestEndpointOrder(t *testing.T) {
+	const a, b, c = "https://a.example.com", "https://b.example.com", "https://c.example.com"
+	servers := parseServers(t, a, b, c)
+
+	tests := []struct {
+		name      string
+		selection string
+		preferred string
+		unhealthy []string
+		expected  [][]string
+	}{
+		{name: "failover", selection: SelectionFailover, expected: [][]string{{a, b, c}, {a, b, c}}},
+		{name: "default is failover", expected: [][]string{{a, b, c}, {a, b, c}}},
+		{name: "round robin", selection: SelectionRoundRobin, expected: [][]string{{a, b, c}, {b, c, a}, {c, a, b}, {a, b, c}}},
+		{name: "preferred first", selection: SelectionFailover, preferred: c, expected: [][]string{{c, a, b}}},
+		{name: "unknown preferred", selection: SelectionFailover, preferred: "https://d.example.com", expected: [][]string{{a, b, c}}},
+		{name: "unhealthy last", selection: SelectionFailover, unhealthy: []string{a}, expected: [][]string{{b, c, a}}},
+		{name: "unhealthy in order", selection: SelectionFailover, unhealthy: []string{b, a}, expected: [][]string{{c, a, b}}},
+		{name: "preferred before healthy", selection: SelectionFailover, preferred: b, unhealthy: []string{b}, expected: [][]string{{b, a, c}}},
+		{name: "round robin unhealthy last", selection: SelectionRoundRobin, unhealthy: []string{b}, expected: [][]string{{a, c, b}, {c, a, b}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newEndpointTracker()
+			for _, server := range tt.unhealthy {
+				tracker.markUnhealthy(server)
+			}
+			for i, expected := range tt.expected {
+				if got := orderOf(tracker.order(servers, tt.selection, tt.preferred)); !slices.Equal(got, expected) {
+					t.Errorf("call %d: expected %v, got %v", i, expected, got)
+				}
+			}
+			if !slices.Equal(orderOf(servers), []string{a, b, c}) {
+				t.Error("servers modified")
+			}
+		})
+	}
+}
+
+func TestEndpointHealth(t *testing.T) {
+	const a, b = "https://a.example.com", "https://b.example.com"
+	servers := parseServers(t, a, b)
+	tracker := newEndpointTracker()
+
+	tracker.markUnhealthy(a)
+	if got := orderOf(tracker.order(servers, SelectionFailover, "")); !slices.Equal(got, []string{b, a}) {
+		t.Errorf("expected unhealthy server last, got %v", got)
+	}
+	tracker.markHealthy(a)
+	if got := orderOf(tracker.order(servers, SelectionFailover, "")); !slices.Equal(got, []string{a, b}) {
+		t.Errorf("expected recovered server first, got %v", got)
+	}
+}
+
+func TestEndpointPresented(t *testing.T) {
+	tracker := newEndpointTracker()
+	tracker.rememberPresent("_acme-challenge.example.com.", "key", "https://b.example.com")
+	if server := tracker.presentedBy("_acme-challenge.example.com.", "key"); server != "https://b.example.com" {
+		t.Errorf("expected the presenting server, got %q", server)
+	}
+	if server := tracker.presentedBy("_acme-challenge.example.com.", "other"); server != "" {
+		t.Errorf("expected no server for another key, got %q", server)
+	}
+	tracker.forgetPresent("_acme-challenge.example.com.", "key")
+	if server := tracker.presentedBy("_acme-challenge.example.com.", "key"); server != "" {
+		t.Errorf("expected no server after cleanup, got %q", server)
+	}
+}
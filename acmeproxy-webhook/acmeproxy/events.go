@@ -0,0 +1,135 @@
+package acmeproxy
+
+import (
+	"fmt"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmscheme "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/scheme"
+	cminformers "github.com/cert-manager/cert-manager/pkg/client/informers/externalversions"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"log"
+	"net/http"
+)
+
+const (
+	ReasonInvalidConfig = "InvalidConfig"
+	ReasonPresented     = "Presented"
+	ReasonCleanedUp     = "CleanedUp"
+	ReasonUnauthorized  = "Unauthorized"
+	ReasonForbiddenZone = "ForbiddenZone"
+	ReasonProxyError    = "ProxyError"
+)
+
+const challengeKeyIndex = "spec.key"
+
+// challengeIndexers index challenges by key, to find the Challenge of a ChallengeRequest
+var challengeIndexers = cache.Indexers{
+	challengeKeyIndex: func(obj interface{}) ([]string, error) {
+		return []string{obj.(*cmacme.Challenge).Spec.Key}, nil
+	},
+}
+
+// eventRecorder records events on the Challenge of a ChallengeRequest.
+// ChallengeRequest does not refer to its Challenge, so challenges are looked up by key from an informer.
+type eventRecorder struct {
+	recorder   record.EventRecorder
+	challenges cache.Indexer
+	synced     cache.InformerSynced
+}
+
+func newEventRecorder(kubeClient kubernetes.Interface, cmClient cmclient.Interface, stopCh <-chan struct{}) (*eventRecorder, error) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+
+	factory := cminformers.NewSharedInformerFactory(cmClient, 0)
+	informer := factory.Acme().V1().Challenges().Informer()
+	err := informer.AddIndexers(challengeIndexers)
+	if err != nil {
+		return nil, err
+	}
+	factory.Start(stopCh)
+
+	return &eventRecorder{
+		recorder:   broadcaster.NewRecorder(cmscheme.Scheme, corev1.EventSource{Component: "acmeproxy-webhook"}),
+		challenges: informer.GetIndexer(),
+		synced:     informer.HasSynced,
+	}, nil
+}
+
+// findChallenge returns the Challenge of the request, or nil if not found.
+func (e *eventRecorder) findChallenge(ch *v1alpha1.ChallengeRequest) *cmacme.Challenge {
+	if !e.synced() {
+		return nil
+	}
+	objs, err := e.challenges.ByIndex(challengeKeyIndex, ch.Key)
+	if err != nil {
+		return nil
+	}
+	for _, obj := range objs {
+		challenge := obj.(*cmacme.Challenge)
+		if challenge.Spec.DNSName == ch.DNSName {
+			return challenge
+		}
+	}
+	return nil
+}
+
+func (e *eventRecorder) event(ch *v1alpha1.ChallengeRequest, eventType, reason, messageFmt string, args ...interface{}) {
+	log.Printf("[Solver]: %s %s for %q: %s", eventType, reason, ch.ResolvedFQDN, fmt.Sprintf(messageFmt, args...))
+	if e == nil {
+		return
+	}
+	challenge := e.findChallenge(ch)
+	if challenge == nil {
+		return
+	}
+	e.recorder.Eventf(challenge, eventType, reason, messageFmt, args...)
+
+	// also record on the owning Order, which is what users usually look at first
+	for _, owner := range challenge.OwnerReferences {
+		if owner.Kind != cmacme.OrderKind {
+			continue
+		}
+		e.recorder.Eventf(&corev1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			Namespace:  challenge.Namespace,
+			UID:        owner.UID,
+		}, eventType, reason, messageFmt, args...)
+	}
+}
+
+// result records the result of presenting or cleaning up a challenge.
+func (e *eventRecorder) result(ch *v1alpha1.ChallengeRequest, action string, err error) {
+	if err == nil {
+		reason := ReasonPresented
+		if action == actionCleanup {
+			reason = ReasonCleanedUp
+		}
+		e.event(ch, corev1.EventTypeNormal, reason, "%s TXT record %s succeeded", action, ch.ResolvedFQDN)
+		return
+	}
+
+	reason := ReasonProxyError
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == "unauthorized" || apiErr.Status == http.StatusUnauthorized:
+			reason = ReasonUnauthorized
+		case apiErr.Code == "forbidden_zone" || apiErr.Status == http.StatusForbidden:
+			reason = ReasonForbiddenZone
+		}
+	}
+	e.event(ch, corev1.EventTypeWarning, reason, "%s TXT record %s failed: %s", action, ch.ResolvedFQDN, err)
+}
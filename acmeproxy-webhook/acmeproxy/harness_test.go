@@ -0,0 +1,128 @@
+package acmeproxy
+
+import (
+	"acmeproxy/dns"
+	"acmeproxy/proxy"
+	"context"
+	"fmt"
+	mdns "github.com/miekg/dns"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testZone     = "example.com"
+	testProvider = "test-memory"
+	testUser     = "example"
+	testToken    = "abc123"
+)
+
+// harness is an in-process acmeproxy server with a dns.MemoryProvider, and a DNS server answering from it.
+type harness struct {
+	provider  *dns.MemoryProvider
+	server    *httptest.Server
+	dnsServer string
+}
+
+// newHarness starts the servers, they are stopped when the test finishes.
+// It registers the provider globally, so tests using it must not run in parallel.
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	h := &harness{provider: dns.NewMemoryProvider()}
+	dns.Register(testProvider, func() dns.Provider {
+		return h.provider
+	})
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(fmt.Sprintf(`
+providers:
+  - zone: %[1]s
+    provider: %[2]s
+    config: {}
+users:
+  - name: %[3]s
+    token: %[4]s
+    allowedZones:
+      - zone: %[1]s
+`, testZone, testProvider, testUser, testToken)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := proxy.LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := config.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.server = httptest.NewServer(server.Router())
+	t.Cleanup(h.server.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	dnsServer := &mdns.Server{
+		PacketConn:        conn,
+		Handler:           mdns.HandlerFunc(h.serveDNS),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() {
+		_ = dnsServer.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = dnsServer.Shutdown()
+	})
+	h.dnsServer = conn.LocalAddr().String()
+	return h
+}
+
+func (h *harness) serveDNS(w mdns.ResponseWriter, req *mdns.Msg) {
+	resp := new(mdns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+	for _, q := range req.Question {
+		if q.Qtype != mdns.TypeTXT {
+			continue
+		}
+		for _, value := range h.lookup(q.Name) {
+			resp.Answer = append(resp.Answer, &mdns.TXT{
+				Hdr: mdns.RR_Header{Name: q.Name, Rrtype: mdns.TypeTXT, Class: mdns.ClassINET},
+				Txt: []string{value},
+			})
+		}
+	}
+	_ = w.WriteMsg(resp)
+}
+
+// lookup returns values of TXT records of fqdn in the memory provider
+func (h *harness) lookup(fqdn string) []string {
+	records, err := h.provider.GetRecords(context.Background(), testZone)
+	if err != nil {
+		return nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(fqdn), "."+testZone+".")
+	var values []string
+	for _, r := range records {
+		if r.Type == "TXT" && r.Name == name {
+			values = append(values, r.Value)
+		}
+	}
+	return values
+}
+
+// config is the solver config connecting to the harness server
+func (h *harness) config() map[string]any {
+	return map[string]any{
+		"server": h.server.URL,
+		"user":   testUser,
+		"token":  testToken,
+	}
+}
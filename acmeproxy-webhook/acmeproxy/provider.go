@@ -2,67 +2,257 @@ package acmeproxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	cmmetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	"github.com/pkg/errors"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 type DNSProviderConfig struct {
-	User           string                     `json:"user"`
-	Token          string                     `json:"token"`
-	Server         string                     `json:"server"`
-	UserSecretRef  cmmetav1.SecretKeySelector `json:"userSecretRef"`
-	TokenSecretRef cmmetav1.SecretKeySelector `json:"tokenSecretRef"`
+	User   string `json:"user"`
+	Token  string `json:"token"`
+	Server string `json:"server"`
+	// Servers are additional servers, tried in order after Server
+	Servers []string `json:"servers"`
+	// ServerSelection is how servers are tried, failover (default) or roundRobin,
+	// either way, servers which failed recently are tried last
+	ServerSelection string            `json:"serverSelection"`
+	UserSecretRef   SecretKeySelector `json:"userSecretRef"`
+	TokenSecretRef  SecretKeySelector `json:"tokenSecretRef"`
+	// CredentialsSecretRef provides server, user, token and CA in one secret,
+	// fields above take precedence over it
+	CredentialsSecretRef *CredentialsSecretRef `json:"credentialsSecretRef"`
+
+	// CABundle is a PEM encoded CA bundle to verify the server, base64 encoded in json
+	CABundle []byte `json:"caBundle"`
+	// CASecretRef refers to a key in a secret containing a PEM encoded CA bundle
+	CASecretRef *SecretKeySelector `json:"caSecretRef"`
+	// ClientCertSecretRef refers to a kubernetes.io/tls secret used as client certificate
+	ClientCertSecretRef *SecretReference `json:"clientCertSecretRef"`
+	// ServerName overrides the server name used to verify the server certificate
+	ServerName string `json:"serverName"`
+	// PublicKeySHA256 pins the server by base64 encoded SHA-256 of a certificate's public key,
+	// any certificate of the verified chain may match, only the server certificate if InsecureSkipVerify is set
+	PublicKeySHA256 []string `json:"publicKeySHA256"`
+	// InsecureSkipVerify disables server certificate verification, use with caution
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+
+	// Timeout of each request to the server, default 10s, all requests of a present or cleanup share a deadline of 25s
+	Timeout *metav1.Duration `json:"timeout"`
+	// Retries is the number of retries on connection errors and 502, 503 and 504 responses not from acmeproxy, default 2
+	Retries *int `json:"retries"`
+
+	// serverURLs are Server and Servers parsed by validate
+	serverURLs []*url.URL
+}
+
+// SecretReference refers to a secret, in the challenge's resource namespace if Namespace is empty.
+type SecretReference struct {
+	cmmetav1.LocalObjectReference `json:",inline"`
+	Namespace                     string `json:"namespace"`
 }
 
+// SecretKeySelector selects a key of a secret, in the challenge's resource namespace if Namespace is empty.
+type SecretKeySelector struct {
+	cmmetav1.SecretKeySelector `json:",inline"`
+	Namespace                  string `json:"namespace"`
+}
+
+const (
+	actionPresent = "present"
+	actionCleanup = "cleanup"
+)
+
+// codeNotFound is the error code of the proxy for a record which does not exist
+const codeNotFound = "not_found"
+
+const (
+	// defaultDeadline bounds a present or cleanup including all retries,
+	// the API server times out calls of the webhook after about 30s
+	defaultDeadline   = 25 * time.Second
+	defaultTimeout    = 10 * time.Second
+	defaultRetries    = 2
+	retryBaseInterval = 500 * time.Millisecond
+	maxResponseSize   = 1 << 20
+)
+
 type request struct {
 	FQDN  string `json:"fqdn"`
 	Value string `json:"value"`
 }
 
+// response is the json body returned by acmeproxy
+type response struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiError is returned when the server responded, but the request failed.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	// FromProxy is set if acmeproxy itself answered, rather than e.g. a reverse proxy in front of it
+	FromProxy bool
+}
+
+func (e *apiError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("acmeproxy returned %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+	}
+	return fmt.Sprintf("acmeproxy returned %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// retryable reports whether another server may succeed. An error of acmeproxy, e.g. a 502 provider_error,
+// is returned as is, as every server uses the same provider.
+func (e *apiError) retryable() bool {
+	if e.FromProxy {
+		return false
+	}
+	switch e.Status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
 type DNSClient struct {
-	client *http.Client
-	cfg    *DNSProviderConfig
+	client  *http.Client
+	cfg     *DNSProviderConfig
+	tracker *endpointTracker
+	// deadline of a request including retries, defaultDeadline if zero
+	deadline time.Duration
 }
 
 // Present a challenge to the DNS provider. This will add a TXT record that the Let's Encrypt
 func (p *DNSClient) present(fqdn, value string) error {
-	err := p._request("present", &request{
+	server, err := p._request(actionPresent, &request{
 		fqdn, value,
-	})
+	}, "")
 	if err != nil {
 		return errors.Wrap(err, "could not present challenge")
 	}
+	p.tracker.rememberPresent(fqdn, value, server)
 	return nil
 }
 
 func (p *DNSClient) cleanup(fqdn, value string) error {
-	err := p._request("cleanup", &request{
+	_, err := p._request(actionCleanup, &request{
 		fqdn, value,
-	})
+	}, p.tracker.presentedBy(fqdn, value))
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code == codeNotFound {
+		// already cleaned up, cert-manager may call CleanUp more than once
+		log.Printf("[Provider]: record %q not found, already cleaned up", fqdn)
+		err = nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "could not cleanup challenge")
 	}
+	p.tracker.forgetPresent(fqdn, value)
 	return nil
 }
 
-func (p *DNSClient) _request(action string, request *request) error {
+// _request sends the request to the servers in order until one succeeds, and returns the server which handled it.
+// A cleanup answered with not_found is sent to the remaining servers too.
+// Servers are tried again with backoff if all of them failed with connection errors,
+// or with 502, 503 or 504 not returned by acmeproxy itself.
+// All attempts share one deadline, the timeout of an attempt is cut to what is left of it.
+func (p *DNSClient) _request(action string, request *request, preferred string) (string, error) {
 	log.Printf("[Provider]: action=%s fqdn=%q value=%q", action, request.FQDN, request.Value)
 	body, err := json.Marshal(request)
 	if err != nil {
-		return errors.Wrap(err, "could not marshal request")
+		return "", errors.Wrap(err, "could not marshal request")
+	}
+	deadline := p.deadline
+	if deadline <= 0 {
+		deadline = defaultDeadline
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	retries := defaultRetries
+	if p.cfg.Retries != nil {
+		retries = *p.cfg.Retries
 	}
+	for attempt := 0; ; attempt++ {
+		// notFound is the error of servers which answered not_found to a cleanup
+		var notFound, failed error
+		for _, server := range p.tracker.order(p.cfg.serverURLs, p.cfg.ServerSelection, preferred) {
+			if ctx.Err() != nil {
+				if failed == nil {
+					failed = ctx.Err()
+				}
+				break
+			}
+			err = p._send(ctx, server, action, body)
+			var apiErr *apiError
+			isAPIErr := errors.As(err, &apiErr)
+			if isAPIErr && action == actionCleanup && apiErr.Code == codeNotFound {
+				// the record may have been presented by another server, e.g. of another site with its own provider
+				p.tracker.markHealthy(server.String())
+				notFound = err
+				continue
+			}
+			if err == nil || (isAPIErr && !apiErr.retryable()) {
+				// the server is up, even if it rejected the request
+				p.tracker.markHealthy(server.String())
+				return server.String(), err
+			}
+			p.tracker.markUnhealthy(server.String())
+			log.Printf("[Provider]: server %s failed: %s", server, err)
+			failed = err
+		}
+		if failed == nil {
+			// every server answered not_found
+			return "", notFound
+		}
+		err = failed
+		if ctx.Err() != nil {
+			return "", errors.Wrapf(err, "gave up after %s", deadline)
+		}
+		if attempt >= retries {
+			return "", err
+		}
 
-	url := fmt.Sprintf("%s/%s", p.cfg.Server, action)
-	log.Printf("[Provider]: POST %s", url)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+		// exponential backoff with full jitter
+		wait := time.Duration(rand.Int63n(int64(retryBaseInterval << attempt)))
+		log.Printf("[Provider]: attempt %d failed, retry in %s: %s", attempt+1, wait, err)
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrapf(err, "gave up after %s", deadline)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// _send posts body to the action of server, within the timeout of an attempt and the deadline of ctx.
+func (p *DNSClient) _send(ctx context.Context, server *url.URL, action string, body []byte) error {
+	timeout := defaultTimeout
+	if p.cfg.Timeout != nil {
+		timeout = p.cfg.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	endpoint := server.JoinPath(action).String()
+	log.Printf("[Provider]: POST %s", endpoint)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		return errors.Wrap(err, "could not create request")
 	}
 
+	req.Header.Set("Content-Type", "application/json")
 	req.SetBasicAuth(p.cfg.User, p.cfg.Token)
 	resp, err := p.client.Do(req)
 	if err != nil {
@@ -71,9 +261,19 @@ func (p *DNSClient) _request(action string, request *request) error {
 
 	//goland:noinspection GoUnhandledErrorResult
 	defer resp.Body.Close()
-	log.Printf("[Provider]: %q %s", resp.Status, resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("could finish request: api returned %s %s", resp.Status, resp.Body)
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return errors.Wrapf(err, "could not read response of %s", resp.Status)
+	}
+	log.Printf("[Provider]: %q %s", resp.Status, content)
+
+	var result response
+	if err := json.Unmarshal(content, &result); err != nil {
+		// not an acmeproxy response, e.g. from a reverse proxy in front of it, even if 200
+		return &apiError{Status: resp.StatusCode, Message: strings.TrimSpace(string(content))}
+	}
+	if resp.StatusCode != http.StatusOK || !result.Success {
+		return &apiError{Status: resp.StatusCode, Code: result.Code, Message: result.Message, FromProxy: result.Code != ""}
 	}
 
 	return nil
@@ -0,0 +1,196 @@
+package acmeproxy
+
+import (
+	"errors"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of the servers without retries
+func newTestClient(t *testing.T, servers ...string) *DNSClient {
+	t.Helper()
+	retries := 0
+	cfg := &DNSProviderConfig{User: "user", Token: "token", Servers: servers, Retries: &retries}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return &DNSClient{client: http.DefaultClient, cfg: cfg, tracker: newEndpointTracker()}
+}
+
+// countingServer answers every request with status and body, and counts them
+func countingServer(t *testing.T, status int, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestRequestErrors(t *testing.T) {
+	const ok = `{"success":true}`
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		// the first server is closed
+		unreachable bool
+		// expected failover to the second server, which succeeds
+		failover bool
+		code     string
+	}{
+		{name: "success", status: http.StatusOK, body: ok},
+		{name: "200 not from acmeproxy", status: http.StatusOK, body: "<html>login</html>"},
+		{name: "provider error", status: http.StatusBadGateway, body: `{"success":false,"code":"provider_error","message":"injected"}`, code: "provider_error"},
+		{name: "forbidden", status: http.StatusForbidden, body: `{"success":false,"code":"forbidden_zone","message":"not allowed"}`, code: "forbidden_zone"},
+		{name: "500 not from acmeproxy", status: http.StatusInternalServerError, body: "internal error"},
+		{name: "502 not from acmeproxy", status: http.StatusBadGateway, body: "bad gateway", failover: true},
+		{name: "503 not from acmeproxy", status: http.StatusServiceUnavailable, body: `{"message":"no endpoints"}`, failover: true},
+		{name: "504 not from acmeproxy", status: http.StatusGatewayTimeout, body: "gateway timeout", failover: true},
+		{name: "connection error", unreachable: true, failover: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, firstHits := countingServer(t, tt.status, tt.body)
+			second, secondHits := countingServer(t, http.StatusOK, ok)
+			firstURL := first.URL
+			if tt.unreachable {
+				firstURL = closed.URL
+			}
+
+			err := newTestClient(t, firstURL, second.URL).present("_acme-challenge.example.com.", "value")
+			wantErr := !tt.failover && tt.body != ok
+			if (err != nil) != wantErr {
+				t.Fatalf("expected error %t, got %v", wantErr, err)
+			}
+			var apiErr *apiError
+			if tt.code != "" && (!errors.As(err, &apiErr) || apiErr.Code != tt.code) {
+				t.Errorf("expected code %s, got %v", tt.code, err)
+			}
+			if !tt.unreachable && firstHits.Load() != 1 {
+				t.Errorf("expected 1 request to the first server, got %d", firstHits.Load())
+			}
+			if tt.failover != (secondHits.Load() == 1) {
+				t.Errorf("expected failover %t, got %d requests to the second server", tt.failover, secondHits.Load())
+			}
+		})
+	}
+}
+
+func TestRequestRetries(t *testing.T) {
+	server, hits := countingServer(t, http.StatusServiceUnavailable, "unavailable")
+	client := newTestClient(t, server.URL)
+	retries := 2
+	client.cfg.Retries = &retries
+	if err := client.present("_acme-challenge.example.com.", "value"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if hits.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", hits.Load())
+	}
+
+	server, hits = countingServer(t, http.StatusBadGateway, `{"success":false,"code":"provider_error","message":"injected"}`)
+	client = newTestClient(t, server.URL)
+	client.cfg.Retries = &retries
+	if err := client.present("_acme-challenge.example.com.", "value"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected no retry of an acmeproxy error, got %d attempts", hits.Load())
+	}
+}
+
+func TestCleanupFailover(t *testing.T) {
+	const notFound = `{"success":false,"code":"not_found","message":"record not found"}`
+	const ok = `{"success":true}`
+
+	tests := []struct {
+		name   string
+		status [2]int
+		body   [2]string
+		// expected requests to each server
+		hits    [2]int32
+		wantErr bool
+	}{
+		{name: "not found on first", status: [2]int{http.StatusNotFound, http.StatusOK}, body: [2]string{notFound, ok}, hits: [2]int32{1, 1}},
+		{name: "not found anywhere", status: [2]int{http.StatusNotFound, http.StatusNotFound}, body: [2]string{notFound, notFound}, hits: [2]int32{1, 1}},
+		{name: "found on first", status: [2]int{http.StatusOK, http.StatusOK}, body: [2]string{ok, ok}, hits: [2]int32{1, 0}},
+		{name: "other error stops", status: [2]int{http.StatusForbidden, http.StatusOK}, body: [2]string{`{"success":false,"code":"forbidden_zone"}`, ok}, hits: [2]int32{1, 0}, wantErr: true},
+		{name: "not found and unreachable", status: [2]int{http.StatusNotFound, http.StatusServiceUnavailable}, body: [2]string{notFound, "unavailable"}, hits: [2]int32{1, 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, firstHits := countingServer(t, tt.status[0], tt.body[0])
+			second, secondHits := countingServer(t, tt.status[1], tt.body[1])
+			err := newTestClient(t, first.URL, second.URL).cleanup("_acme-challenge.example.com.", "value")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if firstHits.Load() != tt.hits[0] || secondHits.Load() != tt.hits[1] {
+				t.Errorf("expected requests %v, got [%d %d]", tt.hits, firstHits.Load(), secondHits.Load())
+			}
+		})
+	}
+}
+
+func TestCleanupPresentingServerFirst(t *testing.T) {
+	first, firstHits := countingServer(t, http.StatusOK, `{"success":true}`)
+	second, secondHits := countingServer(t, http.StatusOK, `{"success":true}`)
+	client := newTestClient(t, first.URL, second.URL)
+	client.tracker.rememberPresent("_acme-challenge.example.com.", "value", second.URL)
+
+	if err := client.cleanup("_acme-challenge.example.com.", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if firstHits.Load() != 0 || secondHits.Load() != 1 {
+		t.Errorf("expected cleanup on the presenting server, got [%d %d]", firstHits.Load(), secondHits.Load())
+	}
+	if server := client.tracker.presentedBy("_acme-challenge.example.com.", "value"); server != "" {
+		t.Errorf("expected the presenting server forgotten, got %q", server)
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	var hits atomic.Int32
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		// the server notices the client is gone only once the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(hanging.Close)
+
+	client := newTestClient(t, hanging.URL, hanging.URL)
+	retries := 5
+	client.cfg.Retries = &retries
+	client.cfg.Timeout = &metav1.Duration{Duration: time.Second}
+	client.deadline = 300 * time.Millisecond
+
+	start := time.Now()
+	err := client.present("_acme-challenge.example.com.", "value")
+	if err == nil || !strings.Contains(err.Error(), "gave up after 300ms") {
+		t.Errorf("expected the deadline exceeded, got %v", err)
+	}
+	// the timeout of the first attempt is cut to the deadline, so the second server and retries are not tried
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to give up at the deadline, took %s", elapsed)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected 1 request, got %d", hits.Load())
+	}
+}
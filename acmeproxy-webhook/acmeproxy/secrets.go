@@ -0,0 +1,70 @@
+package acmeproxy
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"log"
+	"time"
+)
+
+const secretGetTimeout = 10 * time.Second
+
+// secretCache reads secrets from namespaced informers, which are started by Solver.Initialize
+// for allowed namespaces and cert-manager's cluster resource namespace.
+// Secrets of other namespaces, or read before an informer is synced, or not found in cache,
+// are read from the API server, which only needs get on them.
+type secretCache struct {
+	client  kubernetes.Interface
+	listers map[string]*namespaceLister
+}
+
+type namespaceLister struct {
+	lister listersv1.SecretNamespaceLister
+	synced cache.InformerSynced
+}
+
+// newSecretCache starts an informer in each of namespaces
+func newSecretCache(client kubernetes.Interface, namespaces []string, stopCh <-chan struct{}) *secretCache {
+	s := &secretCache{
+		client:  client,
+		listers: make(map[string]*namespaceLister),
+	}
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(ns))
+		secrets := factory.Core().V1().Secrets()
+		s.listers[ns] = &namespaceLister{
+			lister: secrets.Lister().Secrets(ns),
+			synced: secrets.Informer().HasSynced,
+		}
+		factory.Start(stopCh)
+		log.Printf("[Solver]: started secret informer in namespace %q", ns)
+	}
+	return s
+}
+
+func (s *secretCache) get(name, ns string) (*corev1.Secret, error) {
+	if lister, ok := s.listers[ns]; ok && lister.synced() {
+		secret, err := lister.lister.Get(name)
+		if err == nil {
+			return secret, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			log.Printf("[Solver]: failed to read secret %s from cache: %s", ns+"/"+name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretGetTimeout)
+	defer cancel()
+	secret, err := s.client.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load secret %s", ns+"/"+name)
+	}
+	return secret, nil
+}
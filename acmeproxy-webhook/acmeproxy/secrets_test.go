@@ -0,0 +1,75 @@
+package acmeproxy
+
+import (
+	cmmetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"testing"
+)
+
+func TestSecretCache(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cached", Namespace: "allowed"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "direct", Namespace: "other"}},
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	secrets := newSecretCache(client, []string{"allowed"}, stopCh)
+
+	// informers are started up front, only in allowed namespaces
+	if len(secrets.listers) != 1 || secrets.listers["allowed"] == nil {
+		t.Fatalf("expected an informer in namespace allowed, got %v", secrets.listers)
+	}
+	if !cache.WaitForCacheSync(stopCh, secrets.listers["allowed"].synced) {
+		t.Fatal("informer not synced")
+	}
+	client.ClearActions()
+
+	if _, err := secrets.get("cached", "allowed"); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Actions()) != 0 {
+		t.Errorf("expected a cached read, got %v", client.Actions())
+	}
+	if _, err := secrets.get("direct", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Actions()) != 1 || client.Actions()[0].GetVerb() != "get" {
+		t.Errorf("expected a single get, got %v", client.Actions())
+	}
+	if len(secrets.listers) != 1 {
+		t.Error("informer started on use")
+	}
+	if _, err := secrets.get("missing", "other"); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+}
+
+func TestSecretCacheClusterResourceNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "cert-manager"}},
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// the default install, without secret namespaces
+	solver := &Solver{ClusterResourceNamespace: "cert-manager"}
+	solver.secrets = newSecretCache(client, solver.cacheNamespaces(), stopCh)
+	lister := solver.secrets.listers["cert-manager"]
+	if lister == nil {
+		t.Fatalf("expected an informer in the cluster resource namespace, got %v", solver.secrets.listers)
+	}
+	if !cache.WaitForCacheSync(stopCh, lister.synced) {
+		t.Fatal("informer not synced")
+	}
+	client.ClearActions()
+
+	// a secret of a ClusterIssuer, in the challenge resource namespace
+	if _, err := solver.getSecret(SecretReference{LocalObjectReference: cmmetav1.LocalObjectReference{Name: "credentials"}}, "cert-manager"); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Actions()) != 0 {
+		t.Errorf("expected a cached read, got %v", client.Actions())
+	}
+}
@@ -1,20 +1,43 @@
 package acmeproxy
 
 import (
-	"context"
-	"encoding/json"
-	cmmetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
 	"github.com/pkg/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"net/http"
+	"slices"
+	"sync"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
 )
 
+// SecretNamespacesEnv is the environment variable holding a comma separated list of AllowedNamespaces
+const SecretNamespacesEnv = "SECRET_NAMESPACES"
+
+// ClusterResourceNamespaceEnv is the environment variable holding ClusterResourceNamespace
+const ClusterResourceNamespaceEnv = "CLUSTER_RESOURCE_NAMESPACE"
+
 type Solver struct {
+	// AllowedNamespaces are namespaces the solver may read secrets from,
+	// only the challenge resource namespace is allowed if empty
+	AllowedNamespaces []string
+	// ClusterResourceNamespace is cert-manager's namespace for secrets of ClusterIssuers,
+	// its secrets are cached like the ones of AllowedNamespaces
+	ClusterResourceNamespace string
+
 	kubeClient *kubernetes.Clientset
+	secrets    *secretCache
+	events     *eventRecorder
+	endpoints  *endpointTracker
+
+	// clients caches http clients by TLS options, at most maxCachedClients
+	clients   map[string]*cachedClient
+	clientsMu sync.Mutex
+
+	// initOnce initializes a Solver shared with a DirectSolver once
+	initOnce sync.Once
+	initErr  error
 }
 
 func (c *Solver) Name() string {
@@ -29,9 +52,11 @@ func (c *Solver) Name() string {
 func (c *Solver) Present(ch *v1alpha1.ChallengeRequest) error {
 	client, err := c.getClient(ch)
 	if err != nil {
+		c.events.event(ch, corev1.EventTypeWarning, ReasonInvalidConfig, "%s", err)
 		return err
 	}
 	err = client.present(ch.ResolvedFQDN, ch.Key)
+	c.events.result(ch, actionPresent, err)
 	if err != nil {
 		return err
 	}
@@ -48,9 +73,11 @@ func (c *Solver) Present(ch *v1alpha1.ChallengeRequest) error {
 func (c *Solver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
 	client, err := c.getClient(ch)
 	if err != nil {
+		c.events.event(ch, corev1.EventTypeWarning, ReasonInvalidConfig, "%s", err)
 		return err
 	}
 	err = client.cleanup(ch.ResolvedFQDN, ch.Key)
+	c.events.result(ch, actionCleanup, err)
 	if err != nil {
 		return err
 	}
@@ -58,37 +85,100 @@ func (c *Solver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
 	return nil
 }
 
+// Initialize starts the secret cache and the event recorder, it may be called again by a DirectSolver sharing the Solver.
 func (c *Solver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	c.initOnce.Do(func() {
+		c.initErr = c.initialize(kubeClientConfig, stopCh)
+	})
+	return c.initErr
+}
+
+func (c *Solver) initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
 	cl, err := kubernetes.NewForConfig(kubeClientConfig)
 	if err != nil {
 		return err
 	}
 
+	cmClient, err := cmclient.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+
 	c.kubeClient = cl
-	return nil
+	c.secrets = newSecretCache(cl, c.cacheNamespaces(), stopCh)
+	c.endpoints = newEndpointTracker()
+	c.events, err = newEventRecorder(cl, cmClient, stopCh)
+	return err
+}
+
+// cacheNamespaces returns the namespaces to cache secrets of, AllowedNamespaces and ClusterResourceNamespace.
+func (c *Solver) cacheNamespaces() []string {
+	namespaces := slices.Clone(c.AllowedNamespaces)
+	if c.ClusterResourceNamespace != "" && !slices.Contains(namespaces, c.ClusterResourceNamespace) {
+		namespaces = append(namespaces, c.ClusterResourceNamespace)
+	}
+	return namespaces
+}
+
+// secretNamespace returns the namespace to read a secret from,
+// refNamespace defaults to resourceNamespace, and must be in AllowedNamespaces if set.
+func (c *Solver) secretNamespace(refNamespace, resourceNamespace string) (string, error) {
+	if refNamespace == "" {
+		refNamespace = resourceNamespace
+	}
+	if len(c.AllowedNamespaces) == 0 {
+		if refNamespace != resourceNamespace {
+			return "", errors.Errorf("reading secrets from namespace %q is not allowed, "+
+				"only the challenge resource namespace %q is allowed unless %s is set on the webhook",
+				refNamespace, resourceNamespace, SecretNamespacesEnv)
+		}
+		return refNamespace, nil
+	}
+	if !slices.Contains(c.AllowedNamespaces, refNamespace) {
+		return "", errors.Errorf("reading secrets from namespace %q is not allowed, allowed namespaces: %q",
+			refNamespace, c.AllowedNamespaces)
+	}
+	return refNamespace, nil
 }
 
-func (c *Solver) getSecretVal(selector cmmetav1.SecretKeySelector, ns string) ([]byte, error) {
-	secret, err := c.kubeClient.CoreV1().Secrets(ns).Get(context.TODO(), selector.Name, metav1.GetOptions{})
+func (c *Solver) getSecret(ref SecretReference, resourceNamespace string) (*corev1.Secret, error) {
+	ns, err := c.secretNamespace(ref.Namespace, resourceNamespace)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to load secret %s", ns+"/"+selector.Name)
+		return nil, err
+	}
+	secret, err := c.secrets.get(ref.Name, ns)
+	if err != nil && ref.Namespace == "" {
+		return nil, errors.Wrapf(err, "namespace %q is the challenge resource namespace, "+
+			"which is cert-manager's cluster resource namespace for a ClusterIssuer, "+
+			"set namespace on the secret ref to read from another one", ns)
+	}
+	return secret, err
+}
+
+func (c *Solver) getSecretVal(selector SecretKeySelector, resourceNamespace string) ([]byte, error) {
+	secret, err := c.getSecret(SecretReference{
+		LocalObjectReference: selector.LocalObjectReference,
+		Namespace:            selector.Namespace,
+	}, resourceNamespace)
+	if err != nil {
+		return nil, err
 	}
 
 	if data, ok := secret.Data[selector.Key]; ok {
 		return data, nil
 	}
 
-	return nil, errors.Errorf("no key %q in secret %q", selector.Key, ns+"/"+selector.Name)
+	return nil, errors.Errorf("no key %q in secret %q", selector.Key, secret.Namespace+"/"+selector.Name)
 }
 
-func (c *Solver) getClient(ch *v1alpha1.ChallengeRequest) (*DNSClient, error) {
-	config := &DNSProviderConfig{}
-	err := json.Unmarshal(ch.Config.Raw, &config)
+// loadConfig parses the solver config and fills in values from secrets.
+func (c *Solver) loadConfig(ch *v1alpha1.ChallengeRequest) (*DNSProviderConfig, error) {
+	config, err := parseConfig(ch)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not unmarshal config json")
+		return nil, err
 	}
 
-	if config.Token == "" {
+	if config.Token == "" && config.TokenSecretRef.Name != "" {
 		data, err := c.getSecretVal(config.TokenSecretRef, ch.ResourceNamespace)
 		if err != nil {
 			return nil, err
@@ -96,7 +186,7 @@ func (c *Solver) getClient(ch *v1alpha1.ChallengeRequest) (*DNSClient, error) {
 		config.Token = string(data)
 	}
 
-	if config.User == "" {
+	if config.User == "" && config.UserSecretRef.Name != "" {
 		data, err := c.getSecretVal(config.UserSecretRef, ch.ResourceNamespace)
 		if err != nil {
 			return nil, err
@@ -104,13 +194,36 @@ func (c *Solver) getClient(ch *v1alpha1.ChallengeRequest) (*DNSClient, error) {
 		config.User = string(data)
 	}
 
-	if config.User == "" || config.Token == "" || config.Server == "" {
-		return nil, errors.New("user, token, and server are required")
+	if config.CredentialsSecretRef != nil {
+		err := c.loadCredentials(config, ch.ResourceNamespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func (c *Solver) getClient(ch *v1alpha1.ChallengeRequest) (*DNSClient, error) {
+	config, err := c.loadConfig(ch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := c.getHTTPClient(config, ch.ResourceNamespace)
+	if err != nil {
+		return nil, err
 	}
 
 	client := &DNSClient{
-		client: &http.Client{},
-		cfg:    config,
+		client:  httpClient,
+		cfg:     config,
+		tracker: c.endpoints,
 	}
 	return client, nil
 }
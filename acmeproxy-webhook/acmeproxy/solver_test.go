@@ -0,0 +1,525 @@
+package acmeproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmmetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
+	mdns "github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestSolver returns a Solver which can be used without a kubernetes cluster, as long as no secret is referenced.
+func newTestSolver() *Solver {
+	return &Solver{endpoints: newEndpointTracker()}
+}
+
+func (h *harness) challenge(t *testing.T, key string) *v1alpha1.ChallengeRequest {
+	t.Helper()
+	raw, err := json.Marshal(h.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &v1alpha1.ChallengeRequest{
+		ResourceNamespace: "default",
+		ResolvedFQDN:      "_acme-challenge." + testZone + ".",
+		ResolvedZone:      testZone + ".",
+		DNSName:           testZone,
+		Key:               key,
+		Config:            &extapi.JSON{Raw: raw},
+	}
+}
+
+// hasRecord checks the harness DNS server for a TXT record
+func (h *harness) hasRecord(t *testing.T, fqdn, value string) bool {
+	t.Helper()
+	msg, err := util.DNSQuery(context.Background(), fqdn, mdns.TypeTXT, []string{h.dnsServer}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range msg.Answer {
+		if txt, ok := rr.(*mdns.TXT); ok && len(txt.Txt) == 1 && txt.Txt[0] == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPresentCleanUpIdempotent(t *testing.T) {
+	h := newHarness(t)
+	solver := newTestSolver()
+	ch := h.challenge(t, "idempotent-key")
+
+	for i := 0; i < 2; i++ {
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("Present #%d: %s", i+1, err)
+		}
+	}
+	if !h.hasRecord(t, ch.ResolvedFQDN, ch.Key) {
+		t.Fatal("record not presented")
+	}
+	if n := len(h.lookup(ch.ResolvedFQDN)); n != 1 {
+		t.Fatalf("expected 1 record after presenting twice, got %d", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := solver.CleanUp(ch); err != nil {
+			t.Fatalf("CleanUp #%d: %s", i+1, err)
+		}
+	}
+	if h.hasRecord(t, ch.ResolvedFQDN, ch.Key) {
+		t.Fatal("record not cleaned up")
+	}
+}
+
+func TestConcurrentKeys(t *testing.T) {
+	h := newHarness(t)
+	solver := newTestSolver()
+
+	var challenges []*v1alpha1.ChallengeRequest
+	for i := 0; i < 10; i++ {
+		challenges = append(challenges, h.challenge(t, fmt.Sprintf("concurrent-key-%d", i)))
+	}
+
+	run := func(action func(*v1alpha1.ChallengeRequest) error) {
+		var wg sync.WaitGroup
+		for _, ch := range challenges {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := action(ch); err != nil {
+					t.Errorf("%s: %s", ch.Key, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	run(solver.Present)
+	for _, ch := range challenges {
+		if !h.hasRecord(t, ch.ResolvedFQDN, ch.Key) {
+			t.Errorf("record %s not presented", ch.Key)
+		}
+	}
+
+	// cleaning up one key must keep the others
+	if err := solver.CleanUp(challenges[0]); err != nil {
+		t.Fatal(err)
+	}
+	if h.hasRecord(t, challenges[0].ResolvedFQDN, challenges[0].Key) {
+		t.Errorf("record %s not cleaned up", challenges[0].Key)
+	}
+	for _, ch := range challenges[1:] {
+		if !h.hasRecord(t, ch.ResolvedFQDN, ch.Key) {
+			t.Errorf("record %s removed by cleanup of another key", ch.Key)
+		}
+	}
+
+	run(solver.CleanUp)
+	for _, ch := range challenges {
+		if h.hasRecord(t, ch.ResolvedFQDN, ch.Key) {
+			t.Errorf("record %s not cleaned up", ch.Key)
+		}
+	}
+}
+
+// newFakeSolver returns a Solver reading secrets of objects from a fake clientset
+func newFakeSolver(allowedNamespaces []string, objects ...runtime.Object) *Solver {
+	client := fake.NewSimpleClientset(objects...)
+	return &Solver{
+		AllowedNamespaces: allowedNamespaces,
+		secrets:           newSecretCache(client, nil, nil),
+		endpoints:         newEndpointTracker(),
+	}
+}
+
+func TestSecretNamespace(t *testing.T) {
+	var objects []runtime.Object
+	for _, ns := range []string{"default", "tenant", "other"} {
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: ns}})
+	}
+
+	tests := []struct {
+		name         string
+		allowed      []string
+		refNamespace string
+		// namespace the secret is read from, or the error
+		namespace string
+		wantErr   string
+	}{
+		{name: "challenge namespace", refNamespace: "", namespace: "default"},
+		{name: "challenge namespace set on ref", refNamespace: "default", namespace: "default"},
+		{name: "other namespace without allowed namespaces", refNamespace: "other", wantErr: `reading secrets from namespace "other" is not allowed`},
+		{name: "listed namespace", allowed: []string{"tenant", "other"}, refNamespace: "other", namespace: "other"},
+		{name: "challenge namespace not listed", allowed: []string{"tenant"}, refNamespace: "", wantErr: `reading secrets from namespace "default" is not allowed`},
+		{name: "namespace not listed", allowed: []string{"tenant"}, refNamespace: "other", wantErr: `reading secrets from namespace "other" is not allowed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solver := newFakeSolver(tt.allowed, objects...)
+			ref := SecretReference{LocalObjectReference: cmmetav1.LocalObjectReference{Name: "credentials"}, Namespace: tt.refNamespace}
+			secret, err := solver.getSecret(ref, "default")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret.Namespace != tt.namespace {
+				t.Errorf("expected secret of namespace %s, got %s", tt.namespace, secret.Namespace)
+			}
+		})
+	}
+}
+
+// configChallenge returns a challenge in namespace default with the raw solver config
+func configChallenge(config string) *v1alpha1.ChallengeRequest {
+	return &v1alpha1.ChallengeRequest{
+		ResourceNamespace: "default",
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		DNSName:           "example.com",
+		Key:               "key",
+		Config:            &extapi.JSON{Raw: []byte(config)},
+	}
+}
+
+func TestCredentialsSecretRef(t *testing.T) {
+	const caPEM = "-----BEGIN CERTIFICATE-----\nMA==\n-----END CERTIFICATE-----\n"
+	basicAuth := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "basic-auth", Namespace: "default"},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("secret-user"),
+			corev1.BasicAuthPasswordKey: []byte("secret-token"),
+		},
+	}
+	opaque := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "opaque", Namespace: "default"},
+		Data: map[string][]byte{
+			"connection.json": []byte(`{"server":"https://secret.example.com","user":"secret-user","token":"secret-token","ca":"` +
+				strings.ReplaceAll(caPEM, "\n", `\n`) + `"}`),
+			"invalid.json": []byte(`{`),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		// expected server, user, token and ca bundle
+		want    [4]string
+		wantErr string
+	}{
+		{
+			name:   "basic auth",
+			config: `{"server":"https://acmeproxy.example.com","credentialsSecretRef":{"name":"basic-auth"}}`,
+			want:   [4]string{"https://acmeproxy.example.com", "secret-user", "secret-token", ""},
+		},
+		{
+			name:   "connection json",
+			config: `{"credentialsSecretRef":{"name":"opaque","key":"connection.json"}}`,
+			want:   [4]string{"https://secret.example.com", "secret-user", "secret-token", caPEM},
+		},
+		{
+			name: "config fields take precedence",
+			config: `{"server":"https://config.example.com","user":"config-user","token":"config-token","caBundle":"` +
+				base64.StdEncoding.EncodeToString([]byte(caPEM+caPEM)) + `","credentialsSecretRef":{"name":"opaque","key":"connection.json"}}`,
+			want: [4]string{"https://config.example.com", "config-user", "config-token", caPEM + caPEM},
+		},
+		{
+			name:    "not basic auth without key",
+			config:  `{"credentialsSecretRef":{"name":"opaque"}}`,
+			wantErr: `credentials secret "default/opaque" must be of type "kubernetes.io/basic-auth"`,
+		},
+		{
+			name:    "missing key",
+			config:  `{"credentialsSecretRef":{"name":"opaque","key":"missing.json"}}`,
+			wantErr: `no key "missing.json" in secret "default/opaque"`,
+		},
+		{
+			name:    "invalid json",
+			config:  `{"credentialsSecretRef":{"name":"opaque","key":"invalid.json"}}`,
+			wantErr: `could not unmarshal connection json in key "invalid.json"`,
+		},
+		{
+			name:    "missing secret",
+			config:  `{"credentialsSecretRef":{"name":"missing"}}`,
+			wantErr: "could not load credentials",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solver := newFakeSolver(nil, basicAuth, opaque)
+			config, err := solver.loadConfig(configChallenge(tt.config))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := [4]string{config.Server, config.User, config.Token, string(config.CABundle)}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// newFakeEventRecorder returns an eventRecorder finding challenges in a static index, recording to the returned FakeRecorder
+func newFakeEventRecorder(t *testing.T, challenges ...*cmacme.Challenge) (*eventRecorder, *record.FakeRecorder) {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, challengeIndexers)
+	for _, challenge := range challenges {
+		if err := indexer.Add(challenge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder := record.NewFakeRecorder(10)
+	return &eventRecorder{recorder: recorder, challenges: indexer, synced: func() bool { return true }}, recorder
+}
+
+// testChallenge is the Challenge of configChallenge
+var testChallenge = &cmacme.Challenge{
+	ObjectMeta: metav1.ObjectMeta{Name: "challenge", Namespace: "default"},
+	Spec:       cmacme.ChallengeSpec{Key: "key", DNSName: "example.com"},
+}
+
+// events drains the events recorded so far
+func events(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			config:  `{"server":"https://acmeproxy.example.com","user":"user","token":"token","sever":"https://acmeproxy.example.com"}`,
+			wantErr: `unknown field "sever"`,
+		},
+		{
+			name:    "bad server scheme",
+			config:  `{"server":"ftp://acmeproxy.example.com","user":"user","token":"token"}`,
+			wantErr: "server: Invalid value: \"ftp://acmeproxy.example.com\": must start with http:// or https://",
+		},
+		{
+			name:    "server without scheme",
+			config:  `{"servers":["https://acmeproxy.example.com","acmeproxy.example.com"],"user":"user","token":"token"}`,
+			wantErr: "servers[1]: Invalid value",
+		},
+		{
+			name:    "missing credentials",
+			config:  `{"server":"https://acmeproxy.example.com"}`,
+			wantErr: "[user: Required value: set user, userSecretRef or credentialsSecretRef, token: Required value",
+		},
+		{
+			name:    "missing server",
+			config:  `{"user":"user","token":"token"}`,
+			wantErr: "server: Required value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solver := newFakeSolver(nil)
+			var recorder *record.FakeRecorder
+			solver.events, recorder = newFakeEventRecorder(t, testChallenge)
+
+			err := solver.Present(configChallenge(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+			recorded := events(recorder)
+			if len(recorded) != 1 || !strings.HasPrefix(recorded[0], "Warning InvalidConfig ") || !strings.Contains(recorded[0], tt.wantErr) {
+				t.Errorf("expected an InvalidConfig event, got %q", recorded)
+			}
+		})
+	}
+}
+
+func TestEventReasons(t *testing.T) {
+	challenge := testChallenge.DeepCopy()
+	challenge.OwnerReferences = []metav1.OwnerReference{{APIVersion: "acme.cert-manager.io/v1", Kind: cmacme.OrderKind, Name: "order"}}
+	recorder, fakeRecorder := newFakeEventRecorder(t, challenge)
+	ch := configChallenge(`{}`)
+
+	tests := []struct {
+		name   string
+		action string
+		err    error
+		event  string
+	}{
+		{"presented", actionPresent, nil, "Normal Presented"},
+		{"cleaned up", actionCleanup, nil, "Normal CleanedUp"},
+		{"unauthorized", actionPresent, &apiError{Status: http.StatusUnauthorized, Code: "unauthorized", FromProxy: true}, "Warning Unauthorized"},
+		{"401 not from acmeproxy", actionPresent, &apiError{Status: http.StatusUnauthorized}, "Warning Unauthorized"},
+		{"forbidden zone", actionPresent, &apiError{Status: http.StatusForbidden, Code: "forbidden_zone", FromProxy: true}, "Warning ForbiddenZone"},
+		{"403 not from acmeproxy", actionCleanup, &apiError{Status: http.StatusForbidden}, "Warning ForbiddenZone"},
+		{"provider error", actionPresent, &apiError{Status: http.StatusBadGateway, Code: "provider_error", FromProxy: true}, "Warning ProxyError"},
+		{"connection error", actionCleanup, errors.New("could not send request"), "Warning ProxyError"},
+	}
+	for _, tt := range tests {
+		recorder.result(ch, tt.action, tt.err)
+		// recorded on the Challenge and its Order
+		recorded := events(fakeRecorder)
+		if len(recorded) != 2 || !strings.HasPrefix(recorded[0], tt.event+" ") || !strings.HasPrefix(recorded[1], tt.event+" ") {
+			t.Errorf("%s: expected 2 events %s, got %q", tt.name, tt.event, recorded)
+		}
+	}
+
+	// a request without a known Challenge records nothing
+	other := configChallenge(`{}`)
+	other.Key = "other"
+	recorder.result(other, actionPresent, nil)
+	if recorded := events(fakeRecorder); len(recorded) != 0 {
+		t.Errorf("expected no event without a Challenge, got %q", recorded)
+	}
+}
+
+// newDirectSolver returns a DirectSolver of the acmeproxy config, using a fake clientset for secrets
+func newDirectSolver(t *testing.T, config string) (*DirectSolver, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	solver := &DirectSolver{Solver: newFakeSolver(nil), ConfigPath: path}
+	return solver, solver.loadServer(stopCh)
+}
+
+const directTestConfig = `
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+users:
+  - name: alice
+    token: alice123
+    allowedZones:
+      - zone: example.com
+`
+
+func TestDirectSolver(t *testing.T) {
+	solver, err := newDirectSolver(t, directTestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorder *record.FakeRecorder
+	solver.events, recorder = newFakeEventRecorder(t, testChallenge)
+	ch := configChallenge(`{"user":"alice","token":"alice123"}`)
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatal(err)
+	}
+	if recorded := events(recorder); len(recorded) != 1 || !strings.HasPrefix(recorded[0], "Normal Presented ") {
+		t.Errorf("expected a Presented event, got %q", recorded)
+	}
+	// the record is in the memory provider
+	if _, err := solver.server.CleanUpRecord(context.Background(), "alice", ch.ResolvedFQDN, ch.Key); err != nil {
+		t.Errorf("expected the presented record, got %v", err)
+	}
+	// cleaning up a record which is gone succeeds
+	if err := solver.CleanUp(ch); err != nil {
+		t.Errorf("expected cleanup to succeed, got %v", err)
+	}
+
+	var apiErr *apiError
+	err = solver.Present(configChallenge(`{"user":"alice","token":"wrong"}`))
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+	other := configChallenge(`{"user":"alice","token":"alice123"}`)
+	other.ResolvedFQDN = "_acme-challenge.example.org."
+	err = solver.Present(other)
+	if !errors.As(err, &apiErr) || apiErr.Code != "forbidden_zone" {
+		t.Errorf("expected forbidden_zone, got %v", err)
+	}
+	err = solver.Present(configChallenge(`{"server":"https://acmeproxy.example.com","user":"alice","token":"alice123"}`))
+	if err == nil || !strings.Contains(err.Error(), "the direct solver does not use a server") {
+		t.Errorf("expected server rejected, got %v", err)
+	}
+}
+
+func TestDirectSolverUnsupported(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		err    string
+	}{
+		{`
+authoritative:
+  nameservers: [ns.example.com]
+providers:
+  - zone: acme.example.com
+    provider: authoritative
+    config: {}
+`, `provider "authoritative" of zone "acme.example.com" not supported by the direct solver`},
+		{directTestConfig + `
+acmeDNS:
+  enabled: true
+  domain: example.com
+`, "acmeDNS not supported by the direct solver"},
+		{directTestConfig + `
+rfc2136:
+  enabled: true
+`, "rfc2136 not supported by the direct solver"},
+	} {
+		if _, err := newDirectSolver(t, tt.config); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestSharedSolverInitializedOnce(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	solver := &Solver{}
+	// nothing is listening, informers retry in the background until stopped
+	config := &rest.Config{Host: "https://127.0.0.1:1"}
+	if err := solver.Initialize(config, stopCh); err != nil {
+		t.Fatal(err)
+	}
+	secrets, events := solver.secrets, solver.events
+
+	// as the DirectSolver sharing it does
+	if err := solver.Initialize(config, stopCh); err != nil {
+		t.Fatal(err)
+	}
+	if solver.secrets != secrets || solver.events != events {
+		t.Error("expected the secret cache and event recorder of the first call")
+	}
+}
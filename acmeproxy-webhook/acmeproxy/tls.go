@@ -0,0 +1,170 @@
+package acmeproxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// tlsOptions is the resolved TLS material of a DNSProviderConfig, secrets already loaded.
+type tlsOptions struct {
+	caBundle           []byte
+	clientCert         []byte
+	clientKey          []byte
+	serverName         string
+	insecureSkipVerify bool
+	publicKeySHA256    []string
+}
+
+func (c *Solver) loadTLSOptions(cfg *DNSProviderConfig, resourceNamespace string) (*tlsOptions, error) {
+	opts := &tlsOptions{
+		caBundle:           cfg.CABundle,
+		serverName:         cfg.ServerName,
+		insecureSkipVerify: cfg.InsecureSkipVerify,
+		publicKeySHA256:    cfg.PublicKeySHA256,
+	}
+
+	if cfg.CASecretRef != nil {
+		data, err := c.getSecretVal(*cfg.CASecretRef, resourceNamespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load ca bundle")
+		}
+		opts.caBundle = append(append(slices.Clone(opts.caBundle), '\n'), data...)
+	}
+
+	if cfg.ClientCertSecretRef != nil {
+		secret, err := c.getSecret(*cfg.ClientCertSecretRef, resourceNamespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load client certificate")
+		}
+		opts.clientCert = secret.Data[corev1.TLSCertKey]
+		opts.clientKey = secret.Data[corev1.TLSPrivateKeyKey]
+		if len(opts.clientCert) == 0 || len(opts.clientKey) == 0 {
+			return nil, errors.Errorf("secret %q must contain %q and %q", secret.Namespace+"/"+secret.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+	}
+	return opts, nil
+}
+
+// cacheKey identifies the options, so clients with the same TLS config share a transport.
+func (o *tlsOptions) cacheKey() string {
+	h := sha256.New()
+	for _, b := range [][]byte{o.caBundle, o.clientCert, o.clientKey, []byte(o.serverName)} {
+		_, _ = fmt.Fprintf(h, "%d:", len(b))
+		h.Write(b)
+	}
+	_, _ = fmt.Fprintf(h, "%t:%q", o.insecureSkipVerify, o.publicKeySHA256)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (o *tlsOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         o.serverName,
+		InsecureSkipVerify: o.insecureSkipVerify,
+	}
+
+	if len(o.caBundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(o.caBundle) {
+			return nil, errors.New("no valid PEM certificate found in ca bundle")
+		}
+		config.RootCAs = pool
+	}
+
+	if o.clientCert != nil {
+		cert, err := tls.X509KeyPair(o.clientCert, o.clientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(o.publicKeySHA256) > 0 {
+		config.VerifyConnection = o.verifyPin
+	}
+	return config, nil
+}
+
+// verifyPin checks a certificate of a verified chain matches a pinned public key.
+// PeerCertificates are whatever the server sent, so if verification is skipped,
+// only the leaf is checked, which the server proved to own in the handshake.
+func (o *tlsOptions) verifyPin(state tls.ConnectionState) error {
+	var candidates []*x509.Certificate
+	for _, chain := range state.VerifiedChains {
+		candidates = append(candidates, chain...)
+	}
+	if len(state.VerifiedChains) == 0 && len(state.PeerCertificates) > 0 {
+		candidates = state.PeerCertificates[:1]
+	}
+	for _, cert := range candidates {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if slices.Contains(o.publicKeySHA256, base64.StdEncoding.EncodeToString(sum[:])) {
+			return nil
+		}
+	}
+	return errors.New("no certificate of the server matches a pinned public key")
+}
+
+// maxCachedClients bounds the client cache, rotating a secret or a CA creates a new client each time
+const maxCachedClients = 16
+
+type cachedClient struct {
+	client   *http.Client
+	lastUsed time.Time
+}
+
+// getHTTPClient returns a client for the TLS options of cfg, clients are cached per option,
+// the least recently used one is evicted when the cache is full.
+func (c *Solver) getHTTPClient(cfg *DNSProviderConfig, resourceNamespace string) (*http.Client, error) {
+	opts, err := c.loadTLSOptions(cfg, resourceNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	key := opts.cacheKey()
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+	if cached, ok := c.clients[key]; ok {
+		cached.lastUsed = time.Now()
+		return cached.client, nil
+	}
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+
+	if c.clients == nil {
+		c.clients = make(map[string]*cachedClient)
+	}
+	for len(c.clients) >= maxCachedClients {
+		c.evictOldestClient()
+	}
+	c.clients[key] = &cachedClient{client: client, lastUsed: time.Now()}
+	return client, nil
+}
+
+// evictOldestClient removes the least recently used client, a request still using it completes,
+// its idle connections are closed.
+func (c *Solver) evictOldestClient() {
+	var oldestKey string
+	var oldest *cachedClient
+	for key, cached := range c.clients {
+		if oldest == nil || cached.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, cached
+		}
+	}
+	delete(c.clients, oldestKey)
+	oldest.client.CloseIdleConnections()
+}
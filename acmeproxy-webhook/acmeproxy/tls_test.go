@@ -0,0 +1,170 @@
+package acmeproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientCache(t *testing.T) {
+	solver := &Solver{}
+	first, err := solver.getHTTPClient(&DNSProviderConfig{ServerName: "proxy-0"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := solver.getHTTPClient(&DNSProviderConfig{ServerName: "proxy-0"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != again {
+		t.Error("expected the cached client for the same TLS options")
+	}
+
+	// e.g. a rotated ca bundle or client certificate each time
+	for i := 1; i <= 2*maxCachedClients; i++ {
+		if _, err := solver.getHTTPClient(&DNSProviderConfig{ServerName: fmt.Sprintf("proxy-%d", i)}, "default"); err != nil {
+			t.Fatal(err)
+		}
+		// keep the first one in use
+		if _, err := solver.getHTTPClient(&DNSProviderConfig{ServerName: "proxy-0"}, "default"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(solver.clients) != maxCachedClients {
+		t.Errorf("expected %d cached clients, got %d", maxCachedClients, len(solver.clients))
+	}
+	again, err = solver.getHTTPClient(&DNSProviderConfig{ServerName: "proxy-0"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != again {
+		t.Error("recently used client evicted")
+	}
+}
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a CA if parent is nil, and a certificate of 127.0.0.1 signed by parent otherwise
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) pin() string {
+	sum := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (c *testCert) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+// serveTLS starts a server sending leaf and the extra certificates as its chain
+func serveTLS(t *testing.T, leaf *testCert, extra ...*testCert) string {
+	t.Helper()
+	chain := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}
+	for _, c := range extra {
+		chain.Certificate = append(chain.Certificate, c.cert.Raw)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{chain}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestPublicKeyPin(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	leaf := newTestCert(t, "acmeproxy", ca)
+	server := serveTLS(t, leaf, ca)
+	// an attacker's certificate, which sends the public certificate of the proxy along in its chain
+	foreignCA := newTestCert(t, "foreign ca", nil)
+	foreign := newTestCert(t, "foreign", foreignCA)
+	attacker := serveTLS(t, foreign, leaf, ca)
+	other := newTestCert(t, "other", nil)
+
+	tests := []struct {
+		name     string
+		url      string
+		insecure bool
+		pins     []string
+		wantErr  bool
+	}{
+		{name: "leaf of verified chain", url: server, pins: []string{leaf.pin()}},
+		{name: "ca of verified chain", url: server, pins: []string{other.pin(), ca.pin()}},
+		{name: "no match", url: server, pins: []string{other.pin()}, wantErr: true},
+		{name: "leaf without verification", url: server, insecure: true, pins: []string{leaf.pin()}},
+		// the chain is not verified, so only the leaf counts
+		{name: "ca without verification", url: server, insecure: true, pins: []string{ca.pin()}, wantErr: true},
+		{name: "appended to a verified foreign chain", url: attacker, pins: []string{leaf.pin(), ca.pin()}, wantErr: true},
+		{name: "appended to a foreign chain without verification", url: attacker, insecure: true, pins: []string{leaf.pin(), ca.pin()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := (&Solver{}).getHTTPClient(&DNSProviderConfig{
+				// the foreign CA is trusted, as a public CA would be
+				CABundle:           append(ca.pem(), foreignCA.pem()...),
+				InsecureSkipVerify: tt.insecure,
+				PublicKeySHA256:    tt.pins,
+			}, "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(tt.url)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "no certificate of the server matches a pinned public key") {
+				t.Errorf("expected the pin rejected, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package acmeproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"net/url"
+	"strings"
+)
+
+// parseConfig decodes the solver config, rejecting unknown fields,
+// and validates fields which do not depend on secrets.
+func parseConfig(ch *v1alpha1.ChallengeRequest) (*DNSProviderConfig, error) {
+	if ch.Config == nil {
+		return nil, errors.New("solver config is required")
+	}
+
+	config := &DNSProviderConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(ch.Config.Raw))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid solver config")
+	}
+
+	if errs := config.validateStatic(); len(errs) > 0 {
+		return nil, errors.Wrap(errs.ToAggregate(), "invalid solver config")
+	}
+	return config, nil
+}
+
+func (cfg *DNSProviderConfig) validateStatic() field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, validateKeySelector(field.NewPath("userSecretRef"), &cfg.UserSecretRef, false)...)
+	errs = append(errs, validateKeySelector(field.NewPath("tokenSecretRef"), &cfg.TokenSecretRef, false)...)
+	if cfg.CASecretRef != nil {
+		errs = append(errs, validateKeySelector(field.NewPath("caSecretRef"), cfg.CASecretRef, true)...)
+	}
+	if cfg.ClientCertSecretRef != nil && cfg.ClientCertSecretRef.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("clientCertSecretRef", "name"), ""))
+	}
+	if cfg.CredentialsSecretRef != nil && cfg.CredentialsSecretRef.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("credentialsSecretRef", "name"), ""))
+	}
+
+	if len(cfg.CABundle) > 0 {
+		if block, _ := pem.Decode(cfg.CABundle); block == nil {
+			errs = append(errs, field.Invalid(field.NewPath("caBundle"), "<bytes>", "must be a base64 encoded PEM certificate bundle"))
+		}
+	}
+	for i, pin := range cfg.PublicKeySHA256 {
+		if sum, err := base64.StdEncoding.DecodeString(pin); err != nil || len(sum) != 32 {
+			errs = append(errs, field.Invalid(field.NewPath("publicKeySHA256").Index(i), pin, "must be a base64 encoded SHA-256 digest"))
+		}
+	}
+
+	if cfg.Timeout != nil && cfg.Timeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("timeout"), cfg.Timeout.Duration.String(), "must be positive"))
+	}
+	if cfg.Retries != nil && *cfg.Retries < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("retries"), *cfg.Retries, "must not be negative"))
+	}
+
+	if cfg.Server != "" {
+		if _, err := parseServer(field.NewPath("server"), cfg.Server); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, server := range cfg.Servers {
+		if _, err := parseServer(field.NewPath("servers").Index(i), server); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch cfg.ServerSelection {
+	case "", SelectionFailover, SelectionRoundRobin:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("serverSelection"), cfg.ServerSelection,
+			[]string{SelectionFailover, SelectionRoundRobin}))
+	}
+	return errs
+}
+
+func validateKeySelector(path *field.Path, selector *SecretKeySelector, required bool) field.ErrorList {
+	var errs field.ErrorList
+	if selector.Name == "" && (required || selector.Key != "") {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	if selector.Key == "" && (required || selector.Name != "") {
+		errs = append(errs, field.Required(path.Child("key"), ""))
+	}
+	return errs
+}
+
+// validate checks the config once secrets are loaded, and parses the server url.
+func (cfg *DNSProviderConfig) validate() error {
+	var errs field.ErrorList
+	cfg.serverURLs = nil
+	if cfg.Server == "" && len(cfg.Servers) == 0 {
+		errs = append(errs, field.Required(field.NewPath("server"), "set server, servers, or provide it with credentialsSecretRef"))
+	} else if cfg.Server != "" {
+		if serverURL, err := parseServer(field.NewPath("server"), cfg.Server); err != nil {
+			errs = append(errs, err)
+		} else {
+			cfg.serverURLs = append(cfg.serverURLs, serverURL)
+		}
+	}
+	for i, server := range cfg.Servers {
+		if serverURL, err := parseServer(field.NewPath("servers").Index(i), server); err != nil {
+			errs = append(errs, err)
+		} else {
+			cfg.serverURLs = append(cfg.serverURLs, serverURL)
+		}
+	}
+	if cfg.User == "" {
+		errs = append(errs, field.Required(field.NewPath("user"), "set user, userSecretRef or credentialsSecretRef"))
+	}
+	if cfg.Token == "" {
+		errs = append(errs, field.Required(field.NewPath("token"), "set token, tokenSecretRef or credentialsSecretRef"))
+	}
+	if len(errs) > 0 {
+		return errors.Wrap(errs.ToAggregate(), "invalid solver config")
+	}
+	return nil
+}
+
+// parseServer parses the server url, a path is used as prefix of the api, e.g. https://example.com/acmeproxy
+func parseServer(path *field.Path, server string) (*url.URL, *field.Error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, field.Invalid(path, server, fmt.Sprintf("must be a valid url: %s", err))
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, field.Invalid(path, server, "must start with http:// or https://, e.g. https://acmeproxy.example.com")
+	}
+	if u.Host == "" {
+		return nil, field.Invalid(path, server, "must contain a host, e.g. https://acmeproxy.example.com")
+	}
+	if u.User != nil {
+		return nil, field.Invalid(path, server, "must not contain credentials, use user and token instead")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, field.Invalid(path, server, "must not contain a query or fragment")
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u, nil
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"acmeproxy-webhook/acmeproxy"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
 	"os"
+	"strings"
 )
 
 var GroupName = os.Getenv("GROUP_NAME")
@@ -18,5 +20,26 @@ func main() {
 	// You can register multiple DNS provider implementations with a single
 	// webhook, where the Name() method will be used to disambiguate between
 	// the different implementations.
-	cmd.RunWebhookServer(GroupName, &acmeproxy.Solver{})
+	solver := &acmeproxy.Solver{
+		AllowedNamespaces:        splitList(os.Getenv(acmeproxy.SecretNamespacesEnv)),
+		ClusterResourceNamespace: os.Getenv(acmeproxy.ClusterResourceNamespaceEnv),
+	}
+	solvers := []webhook.Solver{solver}
+	// the direct solver runs providers inside the webhook, it is only available with a config,
+	// it shares the solver, so secrets are cached once
+	if path := os.Getenv(acmeproxy.DirectConfigPathEnv); path != "" {
+		solvers = append(solvers, &acmeproxy.DirectSolver{Solver: solver, ConfigPath: path})
+	}
+	cmd.RunWebhookServer(GroupName, solvers...)
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"acmeproxy/dns"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// runCommand runs a command given in args, and returns false if there is none, to start the server.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "providers":
+		providersCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "usage: acmeproxy [providers [describe <name>]]")
+		os.Exit(2)
+	}
+	return true
+}
+
+// providersCommand lists providers compiled in, or describes the config of one
+func providersCommand(args []string) {
+	if len(args) == 0 {
+		for _, name := range dns.Providers() {
+			fmt.Println(name)
+		}
+		return
+	}
+	if args[0] != "describe" || len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: acmeproxy providers [describe <name>]")
+		os.Exit(2)
+	}
+
+	schema, err := dns.ProviderSchema(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s, see acmeproxy providers\n", err)
+		os.Exit(1)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(schema)
+}
@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrInjected is returned by a call failed by Faults
+var ErrInjected = errors.New("injected failure")
+
+// Faults injects failures into the built-in providers, to test how clients handle a slow or failing provider.
+type Faults struct {
+	// Latency is added to each call, e.g. "200ms"
+	Latency Duration `json:"latency"`
+	// ErrorRate is the probability of a call failing with ErrInjected, from 0 to 1
+	ErrorRate float64 `json:"error_rate"`
+}
+
+func (f *Faults) inject(ctx context.Context) error {
+	if f.Latency > 0 {
+		timer := time.NewTimer(time.Duration(f.Latency))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Duration is a time.Duration read from a string like "1m30s", or a number of nanoseconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v)
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration %q", v)
+		}
+		*d = Duration(parsed)
+	case nil:
+		*d = 0
+	default:
+		return errors.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
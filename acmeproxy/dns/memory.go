@@ -0,0 +1,143 @@
+package dns
+
+import (
+	"context"
+	"github.com/libdns/libdns"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// AuthoritativeProviderName is a memory provider whose zones are served by the DNS server of acmeproxy,
+// so no DNS provider API is used.
+const AuthoritativeProviderName = "authoritative"
+
+func init() {
+	Register("memory", func() Provider {
+		return NewMemoryProvider()
+	})
+	Register(AuthoritativeProviderName, func() Provider {
+		return NewMemoryProvider()
+	})
+}
+
+// MemoryProvider keeps records in memory, for tests and demos without credentials of a real provider.
+// Records are lost when the process exits. Appending a record which already exists does not add it again.
+// Zones and names are case-insensitive, names are stored in lower case.
+type MemoryProvider struct {
+	Faults
+
+	mu      sync.Mutex
+	lastID  int
+	records map[string][]libdns.Record
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{records: make(map[string][]libdns.Record)}
+}
+
+func (m *MemoryProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if err := m.inject(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.records[normalizeZone(zone)]), nil
+}
+
+func (m *MemoryProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := m.inject(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zone = normalizeZone(zone)
+	var appended []libdns.Record
+	for _, r := range recs {
+		r.Name = relativeName(r.Name, zone)
+		i := slices.IndexFunc(m.records[zone], func(e libdns.Record) bool {
+			return e.Type == r.Type && e.Name == r.Name && e.Value == r.Value
+		})
+		if i >= 0 {
+			appended = append(appended, m.records[zone][i])
+			continue
+		}
+		m.lastID++
+		r.ID = strconv.Itoa(m.lastID)
+		m.records[zone] = append(m.records[zone], r)
+		appended = append(appended, r)
+	}
+	return appended, nil
+}
+
+func (m *MemoryProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := m.inject(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zone = normalizeZone(zone)
+	var deleted []libdns.Record
+	for _, r := range recs {
+		m.records[zone] = slices.DeleteFunc(m.records[zone], func(e libdns.Record) bool {
+			if sameRecord(e, r, zone) {
+				deleted = append(deleted, e)
+				return true
+			}
+			return false
+		})
+	}
+	return deleted, nil
+}
+
+// SetRecords replaces records of each name and type in recs with the given ones, like an RRset,
+// records of other names and types are kept.
+func (m *MemoryProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := m.inject(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zone = normalizeZone(zone)
+	type key struct{ name, typ string }
+	sets := make(map[key][]libdns.Record)
+	var order []key
+	for _, r := range recs {
+		r.Name = relativeName(r.Name, zone)
+		k := key{r.Name, r.Type}
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		if !slices.ContainsFunc(sets[k], func(e libdns.Record) bool { return e.Value == r.Value }) {
+			sets[k] = append(sets[k], r)
+		}
+	}
+
+	var kept []libdns.Record
+	existing := make(map[key][]libdns.Record)
+	for _, r := range m.records[zone] {
+		k := key{r.Name, r.Type}
+		if _, ok := sets[k]; ok {
+			existing[k] = append(existing[k], r)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	var set []libdns.Record
+	for _, k := range order {
+		for _, r := range sets[k] {
+			// an unchanged record keeps its id
+			i := slices.IndexFunc(existing[k], func(e libdns.Record) bool { return e.Value == r.Value })
+			if i >= 0 {
+				r.ID = existing[k][i].ID
+			} else {
+				m.lastID++
+				r.ID = strconv.Itoa(m.lastID)
+			}
+			kept = append(kept, r)
+			set = append(set, r)
+		}
+	}
+	m.records[zone] = kept
+	return set, nil
+}
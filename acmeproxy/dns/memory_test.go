@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"context"
+	"github.com/libdns/libdns"
+	"testing"
+)
+
+func TestMemorySetRecords(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMemoryProvider()
+	_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge", Value: "old"},
+		{Type: "TXT", Name: "_acme-challenge", Value: "kept"},
+		{Type: "TXT", Name: "other", Value: "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge.example.com", Value: "kept"},
+		{Type: "TXT", Name: "_acme-challenge.example.com", Value: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 || set[0].ID != "2" || set[1].ID != "4" {
+		t.Errorf("expected kept record with its id and a new one, got %+v", set)
+	}
+
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, r := range records {
+		values[r.Value] = r.Name
+	}
+	if len(records) != 3 || values["other"] != "other" || values["kept"] != "_acme-challenge" || values["new"] != "_acme-challenge" {
+		t.Errorf("expected other, kept and new records, got %+v", records)
+	}
+}
+
+func TestMemoryCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMemoryProvider()
+	_, err := provider.AppendRecords(ctx, "Example.COM.", []libdns.Record{
+		{Type: "TXT", Name: "_ACME-Challenge.Example.com.", Value: "value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge", Value: "value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appended) != 1 || appended[0].ID != "1" || appended[0].Name != "_acme-challenge" {
+		t.Errorf("expected the existing record, got %+v", appended)
+	}
+
+	records, err := provider.GetRecords(ctx, "EXAMPLE.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %+v", records)
+	}
+
+	deleted, err := provider.DeleteRecords(ctx, "example.com.", []libdns.Record{
+		{Type: "TXT", Name: "_Acme-Challenge", Value: "value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected the record deleted, got %+v", deleted)
+	}
+}
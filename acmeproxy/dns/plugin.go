@@ -0,0 +1,255 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/libdns/libdns"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("exec", func() Provider {
+		return &ExecProvider{}
+	})
+	Register("http", func() Provider {
+		return &HTTPProvider{}
+	})
+}
+
+const (
+	pluginGet    = "get"
+	pluginAppend = "append"
+	pluginDelete = "delete"
+
+	defaultPluginTimeout = 30 * time.Second
+	pluginWaitDelay      = time.Second
+	maxPluginResponse    = 1 << 20
+)
+
+// PluginRequest is the JSON sent to a plugin, records are empty for get.
+type PluginRequest struct {
+	Zone    string         `json:"zone"`
+	Records []PluginRecord `json:"records,omitempty"`
+}
+
+// PluginResponse is the JSON returned by a plugin, a non-empty error fails the operation.
+type PluginResponse struct {
+	Records []PluginRecord `json:"records"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// PluginRecord is a libdns.Record, name is relative to the zone, @ for the zone itself.
+// A plugin may return relative or absolute names.
+type PluginRecord struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	TTL      int64  `json:"ttl,omitempty"`
+	Priority uint   `json:"priority,omitempty"`
+	Weight   uint   `json:"weight,omitempty"`
+}
+
+func toPluginRecords(zone string, records []libdns.Record) []PluginRecord {
+	result := make([]PluginRecord, 0, len(records))
+	for _, r := range records {
+		name := libdns.RelativeName(r.Name, zone)
+		if name == "" {
+			name = "@"
+		}
+		result = append(result, PluginRecord{
+			ID:       r.ID,
+			Type:     r.Type,
+			Name:     name,
+			Value:    r.Value,
+			TTL:      int64(r.TTL.Seconds()),
+			Priority: r.Priority,
+			Weight:   r.Weight,
+		})
+	}
+	return result
+}
+
+func fromPluginRecords(records []PluginRecord) []libdns.Record {
+	result := make([]libdns.Record, 0, len(records))
+	for _, r := range records {
+		result = append(result, libdns.Record{
+			ID:       r.ID,
+			Type:     r.Type,
+			Name:     r.Name,
+			Value:    r.Value,
+			TTL:      time.Duration(r.TTL) * time.Second,
+			Priority: r.Priority,
+			Weight:   r.Weight,
+		})
+	}
+	return result
+}
+
+// pluginCall runs an operation of a plugin, encoding the request and decoding the response
+func pluginCall(ctx context.Context, timeout Duration, zone string, records []libdns.Record,
+	run func(ctx context.Context, body []byte) ([]byte, error)) ([]libdns.Record, error) {
+	if timeout <= 0 {
+		timeout = Duration(defaultPluginTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout))
+	defer cancel()
+
+	body, err := json.Marshal(&PluginRequest{Zone: zone, Records: toPluginRecords(zone, records)})
+	if err != nil {
+		return nil, err
+	}
+	output, err := run(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	var response PluginResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, errors.Wrapf(err, "invalid plugin response %q", truncate(output))
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	return fromPluginRecords(response.Records), nil
+}
+
+func truncate(output []byte) string {
+	const limit = 200
+	if len(output) > limit {
+		return string(output[:limit]) + "..."
+	}
+	return string(output)
+}
+
+// ExecProvider runs a command for each operation, for DNS systems not in libdns.
+// The operation (get, append or delete) is appended to the arguments,
+// a PluginRequest is written to stdin, and a PluginResponse is read from stdout.
+type ExecProvider struct {
+	// Command and its arguments
+	Command []string `json:"command"`
+	// Env is added to the environment of the command
+	Env map[string]string `json:"env"`
+	// Timeout of each call, default 30s
+	Timeout Duration `json:"timeout"`
+}
+
+func (e *ExecProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return pluginCall(ctx, e.Timeout, zone, nil, e.run(pluginGet))
+}
+
+func (e *ExecProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return pluginCall(ctx, e.Timeout, zone, recs, e.run(pluginAppend))
+}
+
+func (e *ExecProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return pluginCall(ctx, e.Timeout, zone, recs, e.run(pluginDelete))
+}
+
+func (e *ExecProvider) run(operation string) func(ctx context.Context, body []byte) ([]byte, error) {
+	return func(ctx context.Context, body []byte) ([]byte, error) {
+		if len(e.Command) == 0 {
+			return nil, errors.New("command of exec provider is required")
+		}
+		cmd := exec.CommandContext(ctx, e.Command[0], append(e.Command[1:], operation)...)
+		cmd.Env = os.Environ()
+		for k, v := range e.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		cmd.Stdin = bytes.NewReader(body)
+		// on timeout, do not wait for children of the command still holding its output
+		cmd.WaitDelay = pluginWaitDelay
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s %s failed: %s", e.Command[0], operation, strings.TrimSpace(stderr.String()))
+		}
+		return output, nil
+	}
+}
+
+// HTTPProvider posts a PluginRequest to <endpoint>/get, /append or /delete, and reads a PluginResponse,
+// for DNS systems not in libdns.
+type HTTPProvider struct {
+	// Endpoint is the base url, e.g. https://dns.internal/acmeproxy
+	Endpoint string `json:"endpoint"`
+	// Headers are added to each request, e.g. Authorization
+	Headers map[string]string `json:"headers"`
+	// Timeout of each call, default 30s
+	Timeout Duration `json:"timeout"`
+
+	clientOnce sync.Once
+	client     *http.Client
+}
+
+// httpClient returns the client of the provider, with its own connections and the timeout of a call,
+// which also bounds reading the response body.
+func (h *HTTPProvider) httpClient() *http.Client {
+	h.clientOnce.Do(func() {
+		timeout := time.Duration(h.Timeout)
+		if timeout <= 0 {
+			timeout = defaultPluginTimeout
+		}
+		h.client = &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   timeout,
+		}
+	})
+	return h.client
+}
+
+func (h *HTTPProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return pluginCall(ctx, h.Timeout, zone, nil, h.post(pluginGet))
+}
+
+func (h *HTTPProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return pluginCall(ctx, h.Timeout, zone, recs, h.post(pluginAppend))
+}
+
+func (h *HTTPProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return pluginCall(ctx, h.Timeout, zone, recs, h.post(pluginDelete))
+}
+
+func (h *HTTPProvider) post(operation string) func(ctx context.Context, body []byte) ([]byte, error) {
+	return func(ctx context.Context, body []byte) ([]byte, error) {
+		endpoint, err := url.JoinPath(h.Endpoint, operation)
+		if err != nil || h.Endpoint == "" {
+			return nil, errors.Errorf("invalid endpoint of http provider %q", h.Endpoint)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range h.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := h.httpClient().Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "POST %s failed", endpoint)
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer resp.Body.Close()
+		output, err := io.ReadAll(io.LimitReader(resp.Body, maxPluginResponse))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read response of POST %s", endpoint)
+		}
+		if resp.StatusCode != http.StatusOK {
+			var response PluginResponse
+			if json.Unmarshal(output, &response) == nil && response.Error != "" {
+				return nil, errors.Errorf("POST %s returned %s: %s", endpoint, resp.Status, response.Error)
+			}
+			return nil, errors.Errorf("POST %s returned %s: %s", endpoint, resp.Status, truncate(output))
+		}
+		return output, nil
+	}
+}
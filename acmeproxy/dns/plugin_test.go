@@ -0,0 +1,187 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/libdns/libdns"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pluginScript answers get with a record of $PLUGIN_VALUE, echoes the records of append,
+// fails delete with an error response, and exits with an error on other operations.
+const pluginScript = `#!/bin/sh
+case "$1" in
+get)
+  echo '{"records":[{"type":"TXT","name":"_acme-challenge","value":"'"$PLUGIN_VALUE"'","ttl":60}]}'
+  ;;
+append)
+  cat
+  ;;
+delete)
+  echo '{"error":"record is locked"}'
+  ;;
+invalid)
+  echo 'not json'
+  ;;
+slow)
+  sleep 5
+  ;;
+*)
+  echo "unknown operation $1" >&2
+  exit 3
+  ;;
+esac
+`
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs /bin/sh")
+	}
+	script := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(script, []byte(pluginScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	provider := &ExecProvider{Command: []string{script}, Env: map[string]string{"PLUGIN_VALUE": "from-env"}}
+
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != "from-env" || records[0].TTL != time.Minute {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	appended, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge", Value: "value", TTL: 2 * time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appended) != 1 || appended[0].Value != "value" || appended[0].TTL != 2*time.Minute {
+		t.Errorf("expected the request records, got %+v", appended)
+	}
+
+	if _, err := provider.DeleteRecords(ctx, "example.com", appended); err == nil || err.Error() != "record is locked" {
+		t.Errorf("expected the error of the response, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		command []string
+		timeout Duration
+		err     string
+	}{
+		// the operation is appended to the arguments
+		{command: []string{script, "other"}, err: "unknown operation other"},
+		{command: []string{script, "invalid"}, err: "invalid plugin response"},
+		{command: []string{script, "slow"}, timeout: Duration(100 * time.Millisecond), err: "failed"},
+		{command: []string{filepath.Join(t.TempDir(), "missing")}, err: "failed"},
+		{err: "command of exec provider is required"},
+	} {
+		provider := &ExecProvider{Command: tt.command, Timeout: tt.timeout}
+		_, err := provider.GetRecords(ctx, "example.com")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: expected error containing %q, got %v", tt.command, tt.err, err)
+		}
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	var names []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid token"}`))
+			return
+		}
+		var request PluginRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Zone != "example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/plugin/get":
+			_, _ = io.WriteString(w, `{"records":[{"type":"TXT","name":"_acme-challenge","value":"value"}]}`)
+		case "/plugin/append":
+			for _, record := range request.Records {
+				names = append(names, record.Name)
+			}
+			_ = json.NewEncoder(w).Encode(&PluginResponse{Records: request.Records})
+		case "/plugin/delete":
+			_, _ = io.WriteString(w, `{"error":"record is locked"}`)
+		case "/failing/get":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, `{"error":"backend down"}`)
+		case "/proxy/get":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = io.WriteString(w, `<html>bad gateway</html>`)
+		case "/slow/get":
+			time.Sleep(time.Second)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	headers := map[string]string{"Authorization": "Bearer token"}
+	provider := &HTTPProvider{Endpoint: server.URL + "/plugin", Headers: headers}
+
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != "value" {
+		t.Errorf("unexpected records %+v", records)
+	}
+	appended, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appended) != 1 || appended[0].Value != "new" {
+		t.Errorf("expected the request records, got %+v", appended)
+	}
+	_, err = provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge.foo.example.com", Value: "new"},
+		{Type: "TXT", Name: "example.com.", Value: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "_acme-challenge,_acme-challenge.foo,@" {
+		t.Errorf("expected names relative to the zone, got %q", names)
+	}
+	if _, err := provider.DeleteRecords(ctx, "example.com", appended); err == nil || err.Error() != "record is locked" {
+		t.Errorf("expected the error of the response, got %v", err)
+	}
+	if provider.httpClient() == http.DefaultClient || provider.httpClient().Timeout != defaultPluginTimeout {
+		t.Error("expected a client of the provider with the default timeout")
+	}
+
+	for _, tt := range []struct {
+		endpoint string
+		headers  map[string]string
+		timeout  Duration
+		err      string
+	}{
+		{endpoint: server.URL + "/plugin", err: "401 Unauthorized: invalid token"},
+		{endpoint: server.URL + "/failing", headers: headers, err: "500 Internal Server Error: backend down"},
+		{endpoint: server.URL + "/proxy", headers: headers, err: "502 Bad Gateway: <html>bad gateway</html>"},
+		{endpoint: server.URL + "/slow", headers: headers, timeout: Duration(100 * time.Millisecond), err: "POST " + server.URL + "/slow/get failed"},
+		{endpoint: "", err: "invalid endpoint"},
+	} {
+		provider := &HTTPProvider{Endpoint: tt.endpoint, Headers: tt.headers, Timeout: tt.timeout}
+		_, err := provider.GetRecords(ctx, "example.com")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.endpoint, tt.err, err)
+		}
+	}
+}
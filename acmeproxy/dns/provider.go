@@ -1,10 +1,14 @@
 package dns
 
 // see https://github.com/orgs/libdns/repositories
+//go:generate go run update-libdns-provider-list.go
 
 import (
 	"encoding/json"
 	"github.com/libdns/libdns"
+	"slices"
+	"strings"
+	"sync"
 )
 
 type Provider interface {
@@ -13,11 +17,77 @@ type Provider interface {
 	libdns.RecordAppender
 }
 
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() Provider{}
+)
+
+// Register makes a provider available by name, replacing one registered with the same name.
+// libdns providers register themselves in init() of provider_<name>.go, which are only compiled in
+// if no provider build tag is set, or their own tag is, e.g. go build -tags cloudflare,hetzner
+func Register(name string, factory func() Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// NewProviderByName returns a new provider registered by name, nil if not found
+func NewProviderByName(name string) Provider {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return factory()
+}
+
+// Providers returns names of registered providers, sorted
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
 func NewProviderByNameWithConfig(name string, cfgJson []byte) Provider {
 	p := NewProviderByName(name)
+	if p == nil {
+		return nil
+	}
 	err := json.Unmarshal(cfgJson, p)
 	if err != nil {
 		return nil
 	}
 	return p
 }
+
+// relativeName returns name relative to zone in lower case, "@" for the zone itself,
+// name may be relative already or a fqdn, with or without the trailing dot.
+func relativeName(name, zone string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = normalizeZone(zone)
+	if name == "" || name == "@" || name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
+
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+// sameRecord checks if r is the record to delete, by ID if set, otherwise by type, name and value.
+// Type and value are optional, as in libdns.RecordDeleter.
+func sameRecord(r, target libdns.Record, zone string) bool {
+	if target.ID != "" {
+		return r.ID == target.ID
+	}
+	return relativeName(r.Name, zone) == relativeName(target.Name, zone) &&
+		(target.Type == "" || r.Type == target.Type) &&
+		(target.Value == "" || r.Value == target.Value)
+}
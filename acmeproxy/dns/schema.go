@@ -0,0 +1,275 @@
+package dns
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// secretField matches names of fields holding credentials, they are marked writeOnly,
+// except identifiers, e.g. access_key_id
+var (
+	secretField = regexp.MustCompile(`(?i)(token|secret|password|passwd|passphrase|credential|key)`)
+	idField     = regexp.MustCompile(`(?i)_?id$`)
+)
+
+var (
+	durationType        = reflect.TypeOf(Duration(0))
+	timeDurationType    = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Schema is the subset of JSON Schema describing a provider config.
+// A schema without type accepts any value.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is the schema of values of a map, nil for a struct, which allows no other property
+	AdditionalProperties *Schema `json:"-"`
+	Items                *Schema `json:"items,omitempty"`
+	// WriteOnly marks a secret, e.g. an api token
+	WriteOnly bool `json:"writeOnly,omitempty"`
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type schema Schema
+	var additional any
+	switch {
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		additional = s.AdditionalProperties
+	case s.Type == "object":
+		additional = false
+	}
+	return json.Marshal(&struct {
+		*schema
+		AdditionalProperties any `json:"additionalProperties,omitempty"`
+	}{(*schema)(s), additional})
+}
+
+// ProviderSchema returns the JSON Schema of the config of a registered provider,
+// generated from json tags of its struct.
+func ProviderSchema(name string) (*Schema, error) {
+	p := NewProviderByName(name)
+	if p == nil {
+		return nil, errors.Wrapf(ErrUnknownProvider, "%q", name)
+	}
+	schema := schemaOf(reflect.TypeOf(p), map[reflect.Type]bool{})
+	schema.Schema = schemaDialect
+	schema.Title = name
+	return schema, nil
+}
+
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case durationType:
+		return &Schema{Type: "string", Format: "duration", Description: "e.g. 30s, or seconds as a number"}
+	case timeDurationType:
+		return &Schema{Type: "integer", Description: "nanoseconds"}
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		// decoded by its own code, which accepts values the schema can not tell, so any value is valid here,
+		// and checked by the provider when its config is decoded
+		return &Schema{Description: "decoded by the provider, any value is accepted by the schema"}
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			// a recursive type
+			return &Schema{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(schema, t, visiting)
+		return schema
+	}
+	// interface, func and chan
+	return &Schema{}
+}
+
+// addFields adds properties of exported fields, fields of embedded structs are promoted like encoding/json does
+func addFields(schema *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			addFields(schema, fieldType, visiting)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; ok {
+			// a field of the outer struct wins
+			continue
+		}
+		property := schemaOf(field.Type, visiting)
+		property.WriteOnly = isSecret(name) || isSecret(field.Name)
+		schema.Properties[name] = property
+	}
+}
+
+func isSecret(name string) bool {
+	return secretField.MatchString(name) && !idField.MatchString(name)
+}
+
+// Validate checks a decoded JSON value against the schema, and returns every problem.
+// Unknown properties are not a problem, they are ignored like encoding/json does, and returned as their path,
+// e.g. config.apiToken, so a caller can warn about them or reject them.
+// Property names match case-insensitively, like encoding/json.
+func (s *Schema) Validate(value any) (unknown []string, err error) {
+	v := &validation{}
+	s.validate("config", value, v)
+	if len(v.problems) > 0 {
+		return v.unknown, errors.New(strings.Join(v.problems, "; "))
+	}
+	return v.unknown, nil
+}
+
+type validation struct {
+	problems []string
+	unknown  []string
+}
+
+func (s *Schema) validate(path string, value any, v *validation) {
+	if s.Type == "" || value == nil {
+		return
+	}
+	mismatch := func() {
+		v.problems = append(v.problems, fmt.Sprintf("%s: expected %s, got %s", path, s.Type, typeName(value)))
+	}
+	switch s.Type {
+	case "string":
+		if _, ok := value.(string); !ok && !(s.Format == "duration" && isNumber(value)) {
+			mismatch()
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			mismatch()
+		}
+	case "integer":
+		if f, ok := value.(float64); !ok || f != float64(int64(f)) {
+			mismatch()
+		}
+	case "number":
+		if !isNumber(value) {
+			mismatch()
+		}
+	case "array":
+		values, ok := value.([]any)
+		if !ok {
+			mismatch()
+			return
+		}
+		for i, item := range values {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, v)
+		}
+	case "object":
+		values, ok := value.(map[string]any)
+		if !ok {
+			mismatch()
+			return
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			property := s.AdditionalProperties
+			if property == nil {
+				property = s.property(key)
+			}
+			if property == nil {
+				v.unknown = append(v.unknown, path+"."+key)
+				continue
+			}
+			property.validate(path+"."+key, values[key], v)
+		}
+	}
+}
+
+func (s *Schema) property(name string) *Schema {
+	if property, ok := s.Properties[name]; ok {
+		return property
+	}
+	for key, property := range s.Properties {
+		if strings.EqualFold(key, name) {
+			return property
+		}
+	}
+	return nil
+}
+
+func isNumber(value any) bool {
+	_, ok := value.(float64)
+	return ok
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
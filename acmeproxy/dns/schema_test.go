@@ -0,0 +1,128 @@
+package dns
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProviderSchema(t *testing.T) {
+	schema, err := ProviderSchema("exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"title":"exec"`,
+		`"command":{"type":"array","items":{"type":"string"}}`,
+		`"env":{"type":"object","additionalProperties":{"type":"string"}}`,
+		`"timeout":{"type":"string","format":"duration"`,
+		`"additionalProperties":false}`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %s in %s", expected, content)
+		}
+	}
+
+	schema, err = ProviderSchema("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Properties["error_rate"] == nil || schema.Properties["latency"] == nil {
+		t.Errorf("fields of embedded Faults missing in %+v", schema.Properties)
+	}
+
+	if _, err := ProviderSchema("unknown"); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+func TestSecretFields(t *testing.T) {
+	for name, secret := range map[string]bool{
+		"api_token":         true,
+		"APIToken":          true,
+		"client_secret":     true,
+		"password":          true,
+		"login_key":         true,
+		"access_key_id":     false,
+		"client_id":         false,
+		"endpoint":          false,
+		"resource_group_id": false,
+	} {
+		if isSecret(name) != secret {
+			t.Errorf("expected isSecret(%q) to be %v", name, secret)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ProviderSchema("exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		config string
+		err    string
+	}{
+		{`{"command":["/bin/dns"],"env":{"A":"b"},"timeout":"5s"}`, ""},
+		{`{"Command":["/bin/dns"],"timeout":5}`, ""},
+		{`null`, ""},
+		// unknown properties are not an error
+		{`{"commnd":["/bin/dns"]}`, ""},
+		{`{"command":"/bin/dns"}`, `config.command: expected array, got string`},
+		{`{"command":[1],"env":{"A":true}}`, `config.command[0]: expected string, got number; config.env.A: expected string, got boolean`},
+	} {
+		var config any
+		if err := json.Unmarshal([]byte(tt.config), &config); err != nil {
+			t.Fatal(err)
+		}
+		_, err := schema.Validate(config)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", tt.config, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.config, tt.err, err)
+		}
+	}
+}
+
+func TestSchemaUnknownProperties(t *testing.T) {
+	schema, err := ProviderSchema("exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config any
+	if err := json.Unmarshal([]byte(`{"commnd":["/bin/dns"],"env":{"A":"b"},"Timeout":"5s","extra":1}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := schema.Validate(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys of a map are not unknown
+	if strings.Join(unknown, ",") != "config.commnd,config.extra" {
+		t.Errorf("expected unknown properties commnd and extra, got %v", unknown)
+	}
+}
+
+func TestSchemaJSONUnmarshaler(t *testing.T) {
+	type config struct {
+		Raw json.RawMessage `json:"raw"`
+	}
+	schema := schemaOf(reflect.TypeOf(config{}), map[reflect.Type]bool{})
+	raw := schema.Properties["raw"]
+	if raw == nil || raw.Type != "" || raw.Description == "" {
+		t.Fatalf("expected a described schema without type, got %+v", raw)
+	}
+	var value any
+	if err := json.Unmarshal([]byte(`{"raw":{"any":["value"]}}`), &value); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := schema.Validate(value); err != nil {
+		t.Errorf("expected any value to be valid, got %s", err)
+	}
+}
@@ -0,0 +1,320 @@
+//go:build ignore
+
+// update-libdns-provider-list generates provider_<name>.go for each libdns provider,
+// run it with go generate in acmeproxy/dns.
+//
+// By default, it lists repositories of https://github.com/orgs/libdns/repositories, and checks each one
+// implements Provider in a throwaway module, which requires the libdns version pinned by acmeproxy.
+// A provider requiring another libdns version is excluded, compatible ones are added at the checked version.
+// Compatible providers, their versions and the reasons others are excluded are written to providers.json.
+// With -offline, files are generated from providers.json without network access.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	manifestPath = "providers.json"
+	// moduleDir is the acmeproxy module, relative to acmeproxy/dns where go generate runs
+	moduleDir    = ".."
+	reposURL     = "https://api.github.com/users/libdns/repos?per_page=100"
+	libdnsModule = "github.com/libdns/libdns"
+)
+
+// nonProviders are repositories which are not a provider
+var nonProviders = map[string]string{
+	"libdns":   "this is the interface package",
+	"template": "this is the template package",
+}
+
+// a name is used as package name and build tag
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// e.g. vet: ./check.go:9:20:
+var checkPosition = regexp.MustCompile(`^(vet: )?\S*check\.go:\d+:\d+: `)
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+type Repository struct {
+	Name     string `json:"name"`
+	Archived bool   `json:"archived"`
+}
+
+// Manifest is providers.json
+type Manifest struct {
+	// LibDNS is the version of libdns pinned by acmeproxy, which providers were checked against
+	LibDNS string `json:"libdns"`
+	// Providers compiled in, sorted
+	Providers []string `json:"providers"`
+	// Versions of the provider modules checked
+	Versions map[string]string `json:"versions"`
+	// Excluded repositories and the reason
+	Excluded map[string]string `json:"excluded"`
+}
+
+const fileTemplate = `// Code generated by update-libdns-provider-list.go; DO NOT EDIT.
+
+//go:build %[1]s || !(%[2]s)
+
+package dns
+
+import "github.com/libdns/%[1]s"
+
+func init() {
+	Register("%[1]s", func() Provider {
+		return &%[1]s.Provider{}
+	})
+}
+`
+
+const checkModTemplate = `module check
+
+go 1.22
+
+require ` + libdnsModule + ` %[1]s
+`
+
+// checkTemplate asserts the methods of dns.Provider, without acmeproxy and its other providers
+const checkTemplate = `package check
+
+import (
+	"github.com/libdns/libdns"
+	"github.com/libdns/%[1]s"
+)
+
+var _ interface {
+	libdns.RecordGetter
+	libdns.RecordDeleter
+	libdns.RecordAppender
+} = &%[1]s.Provider{}
+`
+
+// listLibDNSRepos lists all repositories, following pagination
+func listLibDNSRepos() ([]Repository, error) {
+	var repos []Repository
+	for url := reposURL; url != ""; {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+			// the limit of unauthenticated requests is low
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s returned %s: %s", url, resp.Status, body)
+		}
+
+		var page []Repository
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		repos = append(repos, page...)
+
+		url = ""
+		if match := nextLink.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			url = match[1]
+		}
+	}
+	return repos, nil
+}
+
+// check adds the latest version of a provider to a throwaway module requiring libdns at the pinned version,
+// and compiles a package asserting it implements Provider.
+// It returns the version checked, or the reason the provider is excluded.
+func check(name, pinned string) (version string, reason string) {
+	dir, err := os.MkdirTemp("", "libdns-check-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer os.RemoveAll(dir)
+	for file, content := range map[string]string{
+		"go.mod":   fmt.Sprintf(checkModTemplate, pinned),
+		"check.go": fmt.Sprintf(checkTemplate, name),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0666); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	module := "github.com/libdns/" + name
+	if output, err := goCommand(dir, "get", module+"@latest"); err != nil {
+		return "", firstLine(output, err)
+	}
+	if required := moduleVersion(dir, libdnsModule); required != pinned {
+		return "", fmt.Sprintf("requires libdns %s, acmeproxy pins %s", required, pinned)
+	}
+	if output, err := goCommand(dir, "vet", "."); err != nil {
+		return "", firstLine(output, err)
+	}
+	return moduleVersion(dir, module), ""
+}
+
+// moduleVersion returns the version of a module required in dir
+func moduleVersion(dir, module string) string {
+	output, err := goCommand(dir, "list", "-m", "-f", "{{.Version}}", module)
+	if err != nil {
+		log.Fatalf("go list -m %s failed: %s", module, output)
+	}
+	return strings.TrimSpace(output)
+}
+
+func goCommand(dir string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	// the throwaway module is not part of a workspace
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// firstLine returns the first error of go output, e.g. missing method GetRecords
+func firstLine(output string, err error) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "go: downloading") {
+			// drop the position in the temporary package
+			return checkPosition.ReplaceAllString(line, "")
+		}
+	}
+	return err.Error()
+}
+
+func update() *Manifest {
+	repos, err := listLibDNSRepos()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pinned := moduleVersion(moduleDir, libdnsModule)
+	manifest := &Manifest{
+		LibDNS:   pinned,
+		Versions: make(map[string]string),
+		Excluded: make(map[string]string),
+	}
+	for _, repo := range repos {
+		name := repo.Name
+		reason, ok := nonProviders[name]
+		version := ""
+		switch {
+		case ok:
+		case repo.Archived:
+			reason = "repository is archived"
+		case !validName.MatchString(name):
+			reason = "name is not a valid package name and build tag"
+		default:
+			version, reason = check(name, pinned)
+		}
+		if reason != "" {
+			log.Printf("skipping %s because %s", name, reason)
+			manifest.Excluded[name] = reason
+			continue
+		}
+		manifest.Providers = append(manifest.Providers, name)
+		manifest.Versions[name] = version
+	}
+	sort.Strings(manifest.Providers)
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath, append(content, '\n'), 0666); err != nil {
+		log.Fatal(err)
+	}
+	return manifest
+}
+
+func readManifest() *Manifest {
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		log.Fatalf("invalid %s: %s", manifestPath, err)
+	}
+	sort.Strings(manifest.Providers)
+	return &manifest
+}
+
+// generate writes one file per provider, build tags of each file select the provider,
+// all providers are compiled in without tags
+func generate(names []string) {
+	// remove files of providers which are gone
+	old, err := filepath.Glob("provider_*.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range old {
+		if err := os.Remove(file); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	allTags := strings.Join(names, " || ")
+	for _, name := range names {
+		if !validName.MatchString(name) {
+			log.Fatalf("invalid provider name %q in %s", name, manifestPath)
+		}
+		fileContent := fmt.Sprintf(fileTemplate, name, allTags)
+		err := os.WriteFile("provider_"+name+".go", []byte(fileContent), 0666)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func main() {
+	offline := flag.Bool("offline", false, "generate from "+manifestPath+" without listing and checking providers")
+	flag.Parse()
+
+	var manifest *Manifest
+	if *offline {
+		manifest = readManifest()
+	} else {
+		manifest = update()
+	}
+	generate(manifest.Providers)
+	fmt.Printf("Total providers: %d, excluded: %d\n", len(manifest.Providers), len(manifest.Excluded))
+
+	if !*offline {
+		// add the checked versions, then drop modules of providers which are gone
+		for _, name := range manifest.Providers {
+			module := "github.com/libdns/" + name + "@" + manifest.Versions[name]
+			if output, err := goCommand(moduleDir, "get", module); err != nil {
+				log.Fatalf("go get %s failed: %s", module, output)
+			}
+		}
+		if output, err := goCommand(moduleDir, "mod", "tidy"); err != nil {
+			log.Fatalf("go mod tidy failed: %s", output)
+		}
+		if version := moduleVersion(moduleDir, libdnsModule); version != manifest.LibDNS {
+			log.Fatalf("libdns was changed from %s to %s", manifest.LibDNS, version)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"github.com/libdns/libdns"
+	mdns "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("zonefile", func() Provider {
+		return &ZoneFileProvider{}
+	})
+}
+
+const defaultZoneFileTTL = time.Minute
+
+// ZoneFileProvider keeps records in an RFC 1035 zone file, e.g. one served by CoreDNS's file plugin.
+// The file is read on every call and replaced atomically on changes, the serial of its SOA record is increased.
+// It must not be shared by multiple providers.
+type ZoneFileProvider struct {
+	Faults
+	// Path of the zone file, it is created if it does not exist
+	Path string `json:"path"`
+	// TTL of records appended without one, default 1m
+	TTL Duration `json:"ttl"`
+
+	mu sync.Mutex
+}
+
+func (z *ZoneFileProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if err := z.inject(ctx); err != nil {
+		return nil, err
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	zone = normalizeZone(zone)
+	rrs, err := z.read(zone)
+	if err != nil {
+		return nil, err
+	}
+	var records []libdns.Record
+	for _, rr := range rrs {
+		records = append(records, toRecord(rr, zone))
+	}
+	return records, nil
+}
+
+func (z *ZoneFileProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := z.inject(ctx); err != nil {
+		return nil, err
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	zone = normalizeZone(zone)
+	rrs, err := z.read(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var appended []libdns.Record
+	for _, r := range recs {
+		if r.TTL == 0 {
+			r.TTL = time.Duration(z.TTL)
+			if r.TTL == 0 {
+				r.TTL = defaultZoneFileTTL
+			}
+		}
+		rr, err := fromRecord(r, zone)
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, existing := range rrs {
+			if mdns.IsDuplicate(existing, rr) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			rrs = append(rrs, rr)
+		}
+		appended = append(appended, toRecord(rr, zone))
+	}
+	return appended, z.write(zone, rrs)
+}
+
+func (z *ZoneFileProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := z.inject(ctx); err != nil {
+		return nil, err
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	zone = normalizeZone(zone)
+	rrs, err := z.read(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []mdns.RR
+	var deleted []libdns.Record
+	for _, rr := range rrs {
+		record := toRecord(rr, zone)
+		matched := false
+		for _, r := range recs {
+			if sameRecord(record, r, zone) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			deleted = append(deleted, record)
+		} else {
+			kept = append(kept, rr)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	return deleted, z.write(zone, kept)
+}
+
+// read parses the zone file, a missing file is an empty zone
+func (z *ZoneFileProvider) read(zone string) ([]mdns.RR, error) {
+	if z.Path == "" {
+		return nil, errors.New("path of zone file is required")
+	}
+	file, err := os.Open(z.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open zone file %q", z.Path)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer file.Close()
+
+	var rrs []mdns.RR
+	parser := mdns.NewZoneParser(file, mdns.Fqdn(zone), z.Path)
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse zone file %q", z.Path)
+	}
+	return rrs, nil
+}
+
+// write replaces the zone file with rrs, increasing the serial of the SOA record
+func (z *ZoneFileProvider) write(zone string, rrs []mdns.RR) error {
+	var content strings.Builder
+	fmt.Fprintf(&content, "$ORIGIN %s\n", mdns.Fqdn(zone))
+	for _, rr := range rrs {
+		if soa, ok := rr.(*mdns.SOA); ok {
+			soa.Serial++
+		}
+		content.WriteString(rr.String())
+		content.WriteString("\n")
+	}
+
+	// keep the mode of the file, CreateTemp creates it with 0600, which e.g. a DNS server running as another user can not read
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(z.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(z.Path), "."+filepath.Base(z.Path)+".*")
+	if err != nil {
+		return errors.Wrapf(err, "unable to write zone file %q", z.Path)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(content.String())
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), z.Path)
+	}
+	return errors.Wrapf(err, "unable to write zone file %q", z.Path)
+}
+
+func toRecord(rr mdns.RR, zone string) libdns.Record {
+	header := rr.Header()
+	record := libdns.Record{
+		Type: mdns.TypeToString[header.Rrtype],
+		Name: relativeName(header.Name, zone),
+		TTL:  time.Duration(header.Ttl) * time.Second,
+	}
+	switch v := rr.(type) {
+	case *mdns.TXT:
+		record.Value = strings.Join(v.Txt, "")
+	case *mdns.MX:
+		record.Priority = uint(v.Preference)
+		record.Value = v.Mx
+	default:
+		record.Value = strings.TrimPrefix(rr.String(), header.String())
+	}
+	return record
+}
+
+func fromRecord(r libdns.Record, zone string) (mdns.RR, error) {
+	name := mdns.Fqdn(zone)
+	if relative := relativeName(r.Name, zone); relative != "@" {
+		name = relative + "." + name
+	}
+	header := mdns.RR_Header{
+		Name:  name,
+		Class: mdns.ClassINET,
+		Ttl:   uint32(r.TTL.Seconds()),
+	}
+
+	switch r.Type {
+	case "TXT":
+		header.Rrtype = mdns.TypeTXT
+		// a character string is at most 255 bytes
+		var txt []string
+		for value := r.Value; len(value) > 0; {
+			n := min(len(value), 255)
+			txt = append(txt, value[:n])
+			value = value[n:]
+		}
+		return &mdns.TXT{Hdr: header, Txt: txt}, nil
+	case "MX":
+		header.Rrtype = mdns.TypeMX
+		return &mdns.MX{Hdr: header, Preference: uint16(r.Priority), Mx: mdns.Fqdn(r.Value)}, nil
+	default:
+		rr, err := mdns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, header.Ttl, r.Type, r.Value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s record %q", r.Type, r.Name)
+		}
+		return rr, nil
+	}
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"context"
+	"github.com/libdns/libdns"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZoneFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.com.zone")
+	err := os.WriteFile(path, []byte(`$ORIGIN example.com.
+@ 3600 IN SOA ns1 hostmaster 1 7200 3600 1209600 3600
+@ 3600 IN NS ns1
+ns1 3600 IN A 192.0.2.1
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	provider := NewProviderByNameWithConfig("zonefile", []byte(`{"path":"`+path+`"}`))
+	if provider == nil {
+		t.Fatal("zonefile provider not registered")
+	}
+	challenge := libdns.Record{Type: "TXT", Name: "_acme-challenge.foo.example.com", Value: "challenge-value"}
+	for i := 0; i < 2; i++ {
+		if _, err := provider.AppendRecords(ctx, "example.com.", []libdns.Record{challenge}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := provider.GetRecords(ctx, "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []libdns.Record
+	for _, r := range records {
+		if r.Type == "TXT" {
+			found = append(found, r)
+		}
+	}
+	if len(records) != 4 || len(found) != 1 {
+		t.Fatalf("expected SOA, NS, A and one TXT record, got %+v", records)
+	}
+	if found[0].Name != "_acme-challenge.foo" || found[0].Value != "challenge-value" || found[0].TTL != time.Minute {
+		t.Errorf("unexpected TXT record %+v", found[0])
+	}
+
+	deleted, err := provider.DeleteRecords(ctx, "example.com.", found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected 1 deleted record, got %+v", deleted)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "challenge-value") {
+		t.Errorf("record still in zone file:\n%s", content)
+	}
+	// serial is increased on each of the 2 appends and the delete
+	if !strings.Contains(string(content), "hostmaster.example.com. 4 ") {
+		t.Errorf("serial not increased:\n%s", content)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	provider := NewProviderByNameWithConfig("memory", []byte(`{"error_rate":1,"latency":"10ms"}`))
+	if provider == nil {
+		t.Fatal("memory provider not registered")
+	}
+	start := time.Now()
+	_, err := provider.GetRecords(context.Background(), "example.com")
+	if err != ErrInjected {
+		t.Errorf("expected ErrInjected, got %v", err)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("latency not injected")
+	}
+}
+
+func TestZoneFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported")
+	}
+	path := filepath.Join(t.TempDir(), "example.com.zone")
+	if err := os.WriteFile(path, []byte("$ORIGIN example.com.\n@ 3600 IN SOA ns1 hostmaster 1 7200 3600 1209600 3600\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// e.g. readable by a DNS server running as another user
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewProviderByNameWithConfig("zonefile", []byte(`{"path":"`+path+`"}`))
+	challenge := libdns.Record{Type: "TXT", Name: "_acme-challenge", Value: "challenge-value"}
+	if _, err := provider.AppendRecords(context.Background(), "example.com.", []libdns.Record{challenge}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected mode 0644 kept, got %s", info.Mode().Perm())
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"acmeproxy/proxy"
 	"github.com/sirupsen/logrus"
+	"os"
 	"runtime"
 )
 
@@ -19,6 +20,10 @@ func init() {
 }
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	server := proxy.NewServer()
 	server.Serve()
 }
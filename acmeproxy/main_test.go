@@ -1,33 +1,100 @@
 package main
 
 import (
+	"acmeproxy/proxy"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"testing"
 )
 
-func main() {
-	tmp, err := os.CreateTemp("", "test-*.json")
-	if err != nil {
-		panic(err)
-	}
-	//goland:noinspection GoUnhandledErrorResult
-	defer os.Remove(tmp.Name())
-
-	tmp.WriteString(`
+func TestServer(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
 server: 127.0.0.1:8088
 providers:
   - zone: example.com
-    provider: cloudflare
-    config:
-      api_token: your_token_here
+    provider: memory
+    config: {}
 users:
   - name: example
     token: abc123
     allowedZones:
-      - foo.example.com
-`)
+      - zone: foo.example.com
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_PATH", configPath)
+
+	server := httptest.NewServer(proxy.NewServer().Router())
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name   string
+		path   string
+		fqdn   string
+		token  string
+		status int
+	}{
+		{"present", "/present", "_acme-challenge.foo.example.com.", "abc123", http.StatusOK},
+		{"present again", "/present", "_acme-challenge.foo.example.com.", "abc123", http.StatusOK},
+		{"cleanup", "/cleanup", "_acme-challenge.foo.example.com.", "abc123", http.StatusOK},
+		{"cleanup again", "/cleanup", "_acme-challenge.foo.example.com.", "abc123", http.StatusNotFound},
+		{"forbidden zone", "/present", "_acme-challenge.bar.example.com.", "abc123", http.StatusForbidden},
+		{"wrong token", "/present", "_acme-challenge.foo.example.com.", "wrong", http.StatusUnauthorized},
+	} {
+		body := []byte(`{"fqdn":"` + tt.fqdn + `","value":"challenge-value"}`)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v1"+tt.path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("example", tt.token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+	}
 
-	err = os.Setenv("CONFIG_PATH", tmp.Name())
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/providers", nil)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("example", "abc123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var providers proxy.ProvidersResponse
+	err = json.NewDecoder(resp.Body).Decode(&providers)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers.Providers) != 1 || providers.Providers[0].Present != "set" ||
+		!slices.Contains(providers.Providers[0].Capabilities, proxy.CapabilitySet) {
+		t.Errorf("expected memory provider presenting with set, got %+v", providers.Providers)
+	}
+
+	for path, status := range map[string]int{
+		"/v1/providers/memory/schema":  http.StatusOK,
+		"/v1/providers/unknown/schema": http.StatusNotFound,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: expected status %d, got %d", path, status, resp.StatusCode)
+		}
 	}
 }
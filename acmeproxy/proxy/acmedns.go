@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// acmeDNSKeep is the number of TXT records kept per name, as acme-dns does,
+// so a certificate for a domain and its wildcard can be validated at the same time
+const acmeDNSKeep = 2
+
+// acme-dns validates the txt value as a base64url encoded SHA-256 digest
+const acmeDNSTXTLength = 43
+
+var acmeDNSSubdomain = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+type AcmeDNSConfig struct {
+	// Enabled serves an acme-dns compatible api at /acme-dns
+	Enabled bool `yaml:"enabled"`
+	// Domain is where subdomains are, clients CNAME _acme-challenge to <subdomain>.<domain>
+	Domain string `yaml:"domain"`
+}
+
+type AcmeDNSRegisterResponse struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	FullDomain string   `json:"fulldomain"`
+	Subdomain  string   `json:"subdomain"`
+	AllowFrom  []string `json:"allowfrom"`
+}
+
+type AcmeDNSUpdateRequest struct {
+	Subdomain string `json:"subdomain"`
+	TXT       string `json:"txt"`
+}
+
+type AcmeDNSUpdateResponse struct {
+	TXT string `json:"txt"`
+}
+
+type AcmeDNSErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// acmeDNS implements the acme-dns api on top of users and providers.
+// acme-dns credentials are acmeproxy's user and token, subdomains are authorized by the user's allowedZones.
+type acmeDNS struct {
+	server *Server
+	domain string
+
+	// mu guards values, the last TXT values per fqdn, which is lost on restart, and locks
+	mu     sync.Mutex
+	values map[string][]string
+	// locks serialize updates of each fqdn, so provider calls of other subdomains are not blocked
+	locks map[string]*fqdnLock
+}
+
+// fqdnLock is removed from acmeDNS.locks once no update holds or waits for it
+type fqdnLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newAcmeDNS(s *Server, config *AcmeDNSConfig) (*acmeDNS, error) {
+	domain := strings.Trim(strings.ToLower(config.Domain), ".")
+	if domain == "" {
+		return nil, errors.New("acmeDNS.domain is required")
+	}
+	return &acmeDNS{
+		server: s,
+		domain: domain,
+		values: make(map[string][]string),
+		locks:  make(map[string]*fqdnLock),
+	}, nil
+}
+
+// lock locks fqdn and returns the func to unlock it
+func (a *acmeDNS) lock(fqdn string) func() {
+	a.mu.Lock()
+	l, ok := a.locks[fqdn]
+	if !ok {
+		l = &fqdnLock{}
+		a.locks[fqdn] = l
+	}
+	l.refs++
+	a.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(a.locks, fqdn)
+		}
+	}
+}
+
+func (a *acmeDNS) routes(router gin.IRouter) {
+	group := router.Group("/acme-dns")
+	group.GET("/health", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	group.POST("/register", a.auth, a.Register)
+	group.POST("/update", a.auth, a.Update)
+}
+
+// auth accepts X-Api-User and X-Api-Key of acme-dns, or basic auth
+func (a *acmeDNS) auth(ctx *gin.Context) {
+	name, token := ctx.GetHeader("X-Api-User"), ctx.GetHeader("X-Api-Key")
+	if name == "" && token == "" {
+		name, token, _ = ctx.Request.BasicAuth()
+	}
+	if !a.server.Authenticate(name, token) {
+		abortAcmeDNS(ctx, http.StatusUnauthorized, "forbidden")
+		return
+	}
+	ctx.Set(gin.AuthUserKey, name)
+}
+
+// Register returns the credentials of the authenticated user with a new random subdomain.
+// Unlike acme-dns, it does not create users, they are configured statically.
+func (a *acmeDNS) Register(ctx *gin.Context) {
+	user := ctx.MustGet(gin.AuthUserKey).(string)
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		abortAcmeDNS(ctx, http.StatusInternalServerError, "register_failed")
+		return
+	}
+	subdomain := hex.EncodeToString(random)
+	fqdn := subdomain + "." + a.domain
+	if a.server.findTargetZone(user, fqdn) == nil {
+		abortAcmeDNS(ctx, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, &AcmeDNSRegisterResponse{
+		Username:   user,
+		Password:   a.server.users[user].Token,
+		FullDomain: fqdn,
+		Subdomain:  subdomain,
+		AllowFrom:  []string{},
+	})
+}
+
+// Update presents txt at <subdomain>.<domain>, and cleans up the oldest value if there are more than acmeDNSKeep.
+func (a *acmeDNS) Update(ctx *gin.Context) {
+	user := ctx.MustGet(gin.AuthUserKey).(string)
+	var request AcmeDNSUpdateRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		abortAcmeDNS(ctx, http.StatusBadRequest, "malformed_json_payload")
+		return
+	}
+	if !acmeDNSSubdomain.MatchString(request.Subdomain) {
+		abortAcmeDNS(ctx, http.StatusBadRequest, "bad_subdomain")
+		return
+	}
+	if len(request.TXT) != acmeDNSTXTLength {
+		abortAcmeDNS(ctx, http.StatusBadRequest, "bad_txt")
+		return
+	}
+
+	fqdn := strings.ToLower(request.Subdomain) + "." + a.domain
+	unlock := a.lock(fqdn)
+	defer unlock()
+	_, err := a.server.PresentRecord(ctx, user, fqdn, request.TXT)
+	if errors.Is(err, ErrDomainNotAllowed) {
+		abortAcmeDNS(ctx, http.StatusForbidden, "forbidden")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("acme-dns update of %q failed: %s", fqdn, err)
+		abortAcmeDNS(ctx, http.StatusInternalServerError, "update_failed")
+		return
+	}
+
+	// updating with a value kept already moves it to the end
+	a.mu.Lock()
+	values := slices.DeleteFunc(slices.Clone(a.values[fqdn]), func(v string) bool {
+		return v == request.TXT
+	})
+	values = append(values, request.TXT)
+	a.mu.Unlock()
+	for len(values) > acmeDNSKeep {
+		_, err := a.server.CleanUpRecord(ctx, user, fqdn, values[0])
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			logrus.Warnf("acme-dns cleanup of old value of %q failed: %s", fqdn, err)
+		}
+		values = values[1:]
+	}
+	a.mu.Lock()
+	a.values[fqdn] = values
+	a.mu.Unlock()
+
+	ctx.JSON(http.StatusOK, &AcmeDNSUpdateResponse{TXT: request.TXT})
+}
+
+func abortAcmeDNS(ctx *gin.Context, status int, message string) {
+	ctx.AbortWithStatusJSON(status, &AcmeDNSErrorResponse{Error: message})
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const acmeDNSTestConfig = `
+acmeDNS:
+  enabled: true
+  domain: acme.example.com
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+users:
+  - name: alice
+    token: alice123
+    allowedZones:
+      - zone: acme.example.com
+  - name: bob
+    token: bob123
+    allowedZones:
+      - zone: other.example.com
+`
+
+// serveAcmeDNS sends a request with the X-Api-User and X-Api-Key headers of acme-dns
+func serveAcmeDNS(router *gin.Engine, path, user, key, body string) (int, string) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("X-Api-User", user)
+	req.Header.Set("X-Api-Key", key)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code, recorder.Body.String()
+}
+
+// txt returns a valid acme-dns txt value
+func txt(c byte) string {
+	return strings.Repeat(string(c), acmeDNSTXTLength)
+}
+
+func TestAcmeDNSAuth(t *testing.T) {
+	router := newTestServer(t, acmeDNSTestConfig).Router()
+
+	for _, tt := range []struct {
+		name   string
+		status int
+		send   func() (int, string)
+	}{
+		{"api key", http.StatusCreated, func() (int, string) {
+			return serveAcmeDNS(router, "/acme-dns/register", "alice", "alice123", "")
+		}},
+		{"basic auth", http.StatusCreated, func() (int, string) {
+			return serve(t, router, http.MethodPost, "/acme-dns/register", "alice", "alice123", "")
+		}},
+		{"wrong key", http.StatusUnauthorized, func() (int, string) {
+			return serveAcmeDNS(router, "/acme-dns/register", "alice", "wrong", "")
+		}},
+		{"no credentials", http.StatusUnauthorized, func() (int, string) {
+			return serveAcmeDNS(router, "/acme-dns/register", "", "", "")
+		}},
+		{"update with wrong key", http.StatusUnauthorized, func() (int, string) {
+			return serveAcmeDNS(router, "/acme-dns/update", "alice", "wrong", `{"subdomain":"foo","txt":"`+txt('a')+`"}`)
+		}},
+		// the domain is not in bob's allowedZones
+		{"register not allowed", http.StatusForbidden, func() (int, string) {
+			return serveAcmeDNS(router, "/acme-dns/register", "bob", "bob123", "")
+		}},
+	} {
+		status, body := tt.send()
+		if status != tt.status {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.status, status, body)
+			continue
+		}
+		if status != http.StatusCreated {
+			continue
+		}
+		var response AcmeDNSRegisterResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Username != "alice" || response.Password != "alice123" ||
+			response.FullDomain != response.Subdomain+".acme.example.com" || len(response.Subdomain) != 32 {
+			t.Errorf("%s: unexpected registration %+v", tt.name, response)
+		}
+	}
+}
+
+func TestAcmeDNSUpdate(t *testing.T) {
+	router := newTestServer(t, acmeDNSTestConfig).Router()
+
+	for _, tt := range []struct {
+		name   string
+		user   string
+		body   string
+		status int
+		error  string
+	}{
+		{"malformed", "alice", `{`, http.StatusBadRequest, "malformed_json_payload"},
+		{"bad subdomain", "alice", `{"subdomain":"foo..bar","txt":"` + txt('a') + `"}`, http.StatusBadRequest, "bad_subdomain"},
+		{"bad txt", "alice", `{"subdomain":"foo","txt":"short"}`, http.StatusBadRequest, "bad_txt"},
+		{"not allowed", "bob", `{"subdomain":"foo","txt":"` + txt('a') + `"}`, http.StatusForbidden, "forbidden"},
+	} {
+		token := map[string]string{"alice": "alice123", "bob": "bob123"}[tt.user]
+		status, body := serveAcmeDNS(router, "/acme-dns/update", tt.user, token, tt.body)
+		var response AcmeDNSErrorResponse
+		_ = json.Unmarshal([]byte(body), &response)
+		if status != tt.status || response.Error != tt.error {
+			t.Errorf("%s: expected %d %s, got %d %s", tt.name, tt.status, tt.error, status, body)
+		}
+	}
+
+	// the last acmeDNSKeep values are kept
+	for _, value := range []string{txt('a'), txt('b'), txt('c'), txt('b')} {
+		status, body := serveAcmeDNS(router, "/acme-dns/update", "alice", "alice123",
+			`{"subdomain":"Foo","txt":"`+value+`"}`)
+		if status != http.StatusOK || body != `{"txt":"`+value+`"}` {
+			t.Fatalf("update %s: %d %s", value, status, body)
+		}
+	}
+	values := txtValues(t, router, "alice", "alice123", "acme.example.com", "foo.acme.example.com")
+	if !slices.Equal(values, []string{txt('b'), txt('c')}) {
+		t.Errorf("expected the last 2 values, got %v", values)
+	}
+}
+
+func TestAcmeDNSLockPerSubdomain(t *testing.T) {
+	server := newTestServer(t, acmeDNSTestConfig)
+	router := server.Router()
+	update := func(subdomain string) <-chan int {
+		done := make(chan int, 1)
+		go func() {
+			status, _ := serveAcmeDNS(router, "/acme-dns/update", "alice", "alice123",
+				`{"subdomain":"`+subdomain+`","txt":"`+txt('a')+`"}`)
+			done <- status
+		}()
+		return done
+	}
+
+	unlock := server.acmeDNS.lock("foo.acme.example.com")
+	blocked := update("foo")
+	select {
+	case status := <-update("bar"):
+		if status != http.StatusOK {
+			t.Errorf("update of another subdomain: %d", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("update of another subdomain blocked")
+	}
+	select {
+	case <-blocked:
+		t.Fatal("update of a locked subdomain not blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	if status := <-blocked; status != http.StatusOK {
+		t.Errorf("update after unlock: %d", status)
+	}
+	server.acmeDNS.mu.Lock()
+	defer server.acmeDNS.mu.Unlock()
+	if len(server.acmeDNS.locks) != 0 {
+		t.Errorf("expected unused locks removed, got %v", server.acmeDNS.locks)
+	}
+}
+
+func TestAcmeDNSRegisterWithoutCredentials(t *testing.T) {
+	router := newTestServer(t, acmeDNSTestConfig).Router()
+
+	// like the automatic registration of acme-dns clients, which send no credentials
+	req := httptest.NewRequest(http.MethodPost, "/acme-dns/register", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	var response AcmeDNSErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusUnauthorized || response.Error != "forbidden" {
+		t.Errorf("expected 401 forbidden, got %d %s", recorder.Code, recorder.Body)
+	}
+}
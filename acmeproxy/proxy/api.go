@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	_ "embed"
+	"github.com/gin-gonic/gin"
+	"github.com/libdns/libdns"
+	"net/http"
+)
+
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+type ErrorCode string
+
+const (
+	ErrBadRequest    ErrorCode = "bad_request"
+	ErrUnauthorized  ErrorCode = "unauthorized"
+	ErrForbiddenZone ErrorCode = "forbidden_zone"
+	ErrNotFound      ErrorCode = "not_found"
+	ErrResolve       ErrorCode = "resolve_error"
+	ErrProvider      ErrorCode = "provider_error"
+)
+
+var errorStatus = map[ErrorCode]int{
+	ErrBadRequest:    http.StatusBadRequest,
+	ErrUnauthorized:  http.StatusUnauthorized,
+	ErrForbiddenZone: http.StatusForbidden,
+	ErrNotFound:      http.StatusNotFound,
+	ErrResolve:       http.StatusBadGateway,
+	ErrProvider:      http.StatusBadGateway,
+}
+
+type ErrorResponse struct {
+	Success bool      `json:"success"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+type RecordsResponse struct {
+	Success bool     `json:"success"`
+	Records []Record `json:"records"`
+}
+
+type Record struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// TTL in seconds
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+func toRecords(records []libdns.Record) []Record {
+	result := make([]Record, 0, len(records))
+	for _, r := range records {
+		result = append(result, Record{
+			ID:    r.ID,
+			Type:  r.Type,
+			Name:  r.Name,
+			Value: r.Value,
+			TTL:   int64(r.TTL.Seconds()),
+		})
+	}
+	return result
+}
+
+func abortWithError(ctx *gin.Context, code ErrorCode, message string) {
+	ctx.AbortWithStatusJSON(errorStatus[code], &ErrorResponse{
+		Success: false,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// legacyResponseKey is set on requests of the unversioned aliases
+const legacyResponseKey = "acmeproxy/legacyResponse"
+
+// legacyResponse marks requests of the unversioned aliases,
+// which respond with records encoded as libdns.Record, like before the v1 api.
+func legacyResponse(ctx *gin.Context) {
+	ctx.Set(legacyResponseKey, true)
+}
+
+func respondRecords(ctx *gin.Context, records []libdns.Record) {
+	if ctx.GetBool(legacyResponseKey) {
+		ctx.JSON(http.StatusOK, gin.H{
+			"records": records,
+			"success": true,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, &RecordsResponse{
+		Success: true,
+		Records: toRecords(records),
+	})
+}
+
+// basicAuth works like gin.BasicAuth, but responds with an ErrorResponse.
+func (s *Server) basicAuth(ctx *gin.Context) {
+	name, token, ok := ctx.Request.BasicAuth()
+	if !ok || !s.Authenticate(name, token) {
+		ctx.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+		abortWithError(ctx, ErrUnauthorized, "invalid user or token")
+		return
+	}
+	ctx.Set(gin.AuthUserKey, name)
+}
+
+func serveOpenAPI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/yaml", openAPIDocument)
+}
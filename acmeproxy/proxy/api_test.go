@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	mdns "github.com/miekg/dns"
+	"net/http"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	// a resolver failing every query
+	addr := startDNS(t, func(w mdns.ResponseWriter, req *mdns.Msg) {
+		resp := new(mdns.Msg)
+		resp.SetRcode(req, mdns.RcodeServerFailure)
+		_ = w.WriteMsg(resp)
+	})
+	router := newTestServer(t, fmt.Sprintf(`
+cname:
+  enabled: true
+  resolver: %s
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+  - zone: example.net
+    provider: memory
+    config:
+      error_rate: 1
+users:
+  - name: example
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+      - zone: foo.example.net
+  - name: follower
+    token: abc123
+    followCNAME: true
+    allowedZones:
+      - zone: foo.example.com
+`, addr)).Router()
+
+	challenge := func(fqdn string) string {
+		return `{"fqdn":"` + fqdn + `","value":"challenge-value"}`
+	}
+	tests := []struct {
+		code   ErrorCode
+		method string
+		path   string
+		user   string
+		token  string
+		body   string
+	}{
+		{ErrBadRequest, http.MethodPost, "/v1/present", "example", "abc123", `{"fqdn":`},
+		{ErrBadRequest, http.MethodPost, "/v1/present", "example", "abc123", `{}`},
+		{ErrUnauthorized, http.MethodPost, "/v1/present", "example", "wrong", challenge("_acme-challenge.foo.example.com")},
+		{ErrUnauthorized, http.MethodPost, "/v1/present", "", "", challenge("_acme-challenge.foo.example.com")},
+		{ErrForbiddenZone, http.MethodPost, "/v1/present", "example", "abc123", challenge("_acme-challenge.bar.example.com")},
+		{ErrNotFound, http.MethodPost, "/v1/cleanup", "example", "abc123", challenge("_acme-challenge.foo.example.com")},
+		{ErrNotFound, http.MethodGet, "/v1/unknown", "", "", ""},
+		{ErrResolve, http.MethodPost, "/v1/present", "follower", "abc123", challenge("_acme-challenge.foo.example.com")},
+		{ErrProvider, http.MethodPost, "/v1/present", "example", "abc123", challenge("_acme-challenge.foo.example.net")},
+	}
+
+	covered := make(map[ErrorCode]bool)
+	for _, tt := range tests {
+		covered[tt.code] = true
+		status, body := serve(t, router, tt.method, tt.path, tt.user, tt.token, tt.body)
+		var response ErrorResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Errorf("%s %s: invalid error response %q: %s", tt.method, tt.path, body, err)
+			continue
+		}
+		if status != errorStatus[tt.code] || response.Code != tt.code || response.Success || response.Message == "" {
+			t.Errorf("%s %s as %q: expected %d %s, got %d %s", tt.method, tt.path, tt.user, errorStatus[tt.code], tt.code, status, body)
+		}
+	}
+	for code := range errorStatus {
+		if !covered[code] {
+			t.Errorf("error code %s not tested", code)
+		}
+	}
+}
+
+func TestRecordsResponse(t *testing.T) {
+	router := newTestServer(t, `
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+users:
+  - name: example
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+`).Router()
+
+	v1Keys := []string{"id", "type", "name", "value"}
+	// the unversioned aliases keep the encoding of libdns.Record, with the TTL in nanoseconds
+	legacyKeys := []string{"ID", "Type", "Name", "Value", "TTL"}
+	for _, tt := range []struct {
+		path  string
+		value string
+		keys  []string
+	}{
+		{"/v1/present", "v1", v1Keys},
+		{"/present", "legacy", legacyKeys},
+		{"/v1/cleanup", "legacy", v1Keys},
+		{"/cleanup", "v1", legacyKeys},
+	} {
+		status, body := serve(t, router, http.MethodPost, tt.path, "example", "abc123",
+			`{"fqdn":"_acme-challenge.foo.example.com","value":"`+tt.value+`"}`)
+		var response struct {
+			Success bool
+			Records []map[string]any
+		}
+		if err := json.Unmarshal([]byte(body), &response); err != nil || status != http.StatusOK {
+			t.Fatalf("%s: %d %s", tt.path, status, body)
+		}
+		if !response.Success || len(response.Records) != 1 {
+			t.Errorf("%s: expected one record, got %s", tt.path, body)
+			continue
+		}
+		for _, key := range tt.keys {
+			if _, ok := response.Records[0][key]; !ok {
+				t.Errorf("%s: expected key %s, got %s", tt.path, key, body)
+			}
+		}
+	}
+}
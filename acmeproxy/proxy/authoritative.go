@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"acmeproxy/dns"
+	"context"
+	mdns "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuthoritativeListen = ":53"
+	defaultAuthoritativeTTL    = time.Minute
+	authoritativeQueryTimeout  = 5 * time.Second
+)
+
+type AuthoritativeConfig struct {
+	// Listen is the UDP and TCP address of the DNS server, default :53
+	Listen string `yaml:"listen"`
+	// Nameservers of the zones, answered to NS queries, the first one is the primary in SOA
+	Nameservers []string `yaml:"nameservers"`
+	// Hostmaster is the mailbox in SOA, in DNS form, default hostmaster.<zone>
+	Hostmaster string `yaml:"hostmaster"`
+	// TTL of answers, default 1m
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// authoritativeServer answers queries for zones of authoritative providers,
+// e.g. acme.example.com delegated to acmeproxy with a NS record.
+type authoritativeServer struct {
+	config *AuthoritativeConfig
+	listen string
+	ttl    uint32
+	// zones are keyed by lower case name without the trailing dot, like queries are looked up
+	zones map[string]*Provider
+}
+
+// newAuthoritativeServer returns nil if no provider is authoritative.
+func newAuthoritativeServer(c *Config) (*authoritativeServer, error) {
+	zones := make(map[string]*Provider)
+	for _, provider := range c.providers() {
+		if provider.name == dns.AuthoritativeProviderName {
+			zones[strings.ToLower(strings.TrimSuffix(provider.zone, "."))] = provider
+		}
+	}
+	if len(zones) == 0 {
+		return nil, nil
+	}
+	if len(c.Authoritative.Nameservers) == 0 {
+		return nil, errors.Errorf("authoritative.nameservers is required for provider %q", dns.AuthoritativeProviderName)
+	}
+
+	listen := c.Authoritative.Listen
+	if listen == "" {
+		listen = defaultAuthoritativeListen
+	}
+	ttl := c.Authoritative.TTL
+	if ttl <= 0 {
+		ttl = defaultAuthoritativeTTL
+	}
+	return &authoritativeServer{
+		config: &c.Authoritative,
+		listen: listen,
+		ttl:    uint32(ttl.Seconds()),
+		zones:  zones,
+	}, nil
+}
+
+// start listens on UDP and TCP and serves in background
+func (a *authoritativeServer) start() error {
+	packetConn, listener, addr, err := listenDNS(a.listen)
+	if err != nil {
+		return err
+	}
+	a.listen = addr
+
+	for _, server := range []*mdns.Server{
+		{PacketConn: packetConn, Handler: a},
+		{Listener: listener, Handler: a},
+	} {
+		go func() {
+			if err := server.ActivateAndServe(); err != nil {
+				logrus.Errorf("authoritative dns server stopped: %s", err)
+			}
+		}()
+	}
+	logrus.Infof("serving zones %q on %s", a.zoneNames(), addr)
+	return nil
+}
+
+// listenDNS listens on UDP and TCP, on the port picked for UDP if the port is 0,
+// and returns the address listened on.
+func listenDNS(addr string) (net.PacketConn, net.Listener, string, error) {
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, nil, "", errors.Wrapf(err, "unable to listen on udp %s", addr)
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil && port == "0" {
+		addr = net.JoinHostPort(host, strconv.Itoa(packetConn.LocalAddr().(*net.UDPAddr).Port))
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = packetConn.Close()
+		return nil, nil, "", errors.Wrapf(err, "unable to listen on tcp %s", addr)
+	}
+	return packetConn, listener, addr, nil
+}
+
+func (a *authoritativeServer) zoneNames() []string {
+	var names []string
+	for zone := range a.zones {
+		names = append(names, zone)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (a *authoritativeServer) ServeDNS(w mdns.ResponseWriter, req *mdns.Msg) {
+	resp := new(mdns.Msg)
+	resp.SetReply(req)
+	if len(req.Question) != 1 {
+		resp.SetRcode(req, mdns.RcodeFormatError)
+		_ = w.WriteMsg(resp)
+		return
+	}
+	a.answer(resp, req.Question[0])
+	_ = w.WriteMsg(resp)
+}
+
+func (a *authoritativeServer) answer(resp *mdns.Msg, q mdns.Question) {
+	name := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	zone := a.findZone(name)
+	if zone == "" {
+		resp.Rcode = mdns.RcodeRefused
+		return
+	}
+	resp.Authoritative = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), authoritativeQueryTimeout)
+	defer cancel()
+	records, err := a.zones[zone].provider.GetRecords(ctx, zone)
+	if err != nil {
+		logrus.Errorf("unable to get records of %q: %s", zone, err)
+		resp.Rcode = mdns.RcodeServerFailure
+		return
+	}
+
+	relative := "@"
+	if name != zone {
+		relative = strings.TrimSuffix(name, "."+zone)
+	}
+	exists := name == zone
+	for _, r := range records {
+		// queries are case-insensitive, whatever the case a record was presented with
+		r.Name = strings.ToLower(r.Name)
+		if r.Name == relative || strings.HasSuffix(r.Name, "."+relative) {
+			// a name with records below it exists, even without records of its own
+			exists = true
+		}
+		if r.Name == relative && r.Type == "TXT" && (q.Qtype == mdns.TypeTXT || q.Qtype == mdns.TypeANY) {
+			resp.Answer = append(resp.Answer, &mdns.TXT{
+				Hdr: a.header(q.Name, mdns.TypeTXT),
+				Txt: splitTXT(r.Value),
+			})
+		}
+	}
+
+	if name == zone {
+		if q.Qtype == mdns.TypeSOA || q.Qtype == mdns.TypeANY {
+			resp.Answer = append(resp.Answer, a.soa(zone))
+		}
+		if q.Qtype == mdns.TypeNS || q.Qtype == mdns.TypeANY {
+			for _, ns := range a.config.Nameservers {
+				resp.Answer = append(resp.Answer, &mdns.NS{
+					Hdr: a.header(mdns.Fqdn(zone), mdns.TypeNS),
+					Ns:  mdns.Fqdn(ns),
+				})
+			}
+		}
+	}
+
+	if len(resp.Answer) == 0 {
+		if !exists {
+			resp.Rcode = mdns.RcodeNameError
+		}
+		// SOA in authority section for negative caching
+		resp.Ns = append(resp.Ns, a.soa(zone))
+	}
+}
+
+// findZone returns the longest served zone containing name, or an empty string
+func (a *authoritativeServer) findZone(name string) string {
+	found := ""
+	for zone := range a.zones {
+		if (name == zone || strings.HasSuffix(name, "."+zone)) && len(zone) > len(found) {
+			found = zone
+		}
+	}
+	return found
+}
+
+func (a *authoritativeServer) header(name string, rrtype uint16) mdns.RR_Header {
+	return mdns.RR_Header{Name: name, Rrtype: rrtype, Class: mdns.ClassINET, Ttl: a.ttl}
+}
+
+func (a *authoritativeServer) soa(zone string) *mdns.SOA {
+	hostmaster := a.config.Hostmaster
+	if hostmaster == "" {
+		hostmaster = "hostmaster." + zone
+	}
+	return &mdns.SOA{
+		Hdr:  a.header(mdns.Fqdn(zone), mdns.TypeSOA),
+		Ns:   mdns.Fqdn(a.config.Nameservers[0]),
+		Mbox: mdns.Fqdn(hostmaster),
+		// records change at any time, so the serial is the current time like acme-dns does
+		Serial:  uint32(time.Now().Unix()),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  a.ttl,
+	}
+}
+
+// splitTXT splits a value into character strings of at most 255 bytes
+func splitTXT(value string) []string {
+	var txt []string
+	for len(value) > 255 {
+		txt = append(txt, value[:255])
+		value = value[255:]
+	}
+	return append(txt, value)
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	mdns "github.com/miekg/dns"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuthoritative(t *testing.T) {
+	server := newTestServer(t, `
+authoritative:
+  listen: 127.0.0.1:0
+  nameservers:
+    - ns1.example.com
+    - ns2.example.com
+  ttl: 30s
+providers:
+  - zone: acme.example.com
+    provider: authoritative
+    config: {}
+users:
+  - name: alice
+    token: alice123
+    allowedZones:
+      - zone: acme.example.com
+`)
+	if err := server.authoritative.start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := server.authoritative.listen
+
+	status, body := serve(t, server.Router(), http.MethodPost, "/v1/present", "alice", "alice123",
+		`{"fqdn":"_ACME-Challenge.Foo.acme.example.com","value":"challenge-value"}`)
+	if status != http.StatusOK {
+		t.Fatalf("present: %d %s", status, body)
+	}
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		rcode  int
+		answer []string
+	}{
+		{"_acme-challenge.foo.acme.example.com.", mdns.TypeTXT, mdns.RcodeSuccess, []string{"challenge-value"}},
+		{"_Acme-Challenge.FOO.acme.example.com.", mdns.TypeTXT, mdns.RcodeSuccess, []string{"challenge-value"}},
+		{"acme.example.com.", mdns.TypeSOA, mdns.RcodeSuccess, []string{"ns1.example.com."}},
+		{"acme.example.com.", mdns.TypeNS, mdns.RcodeSuccess, []string{"ns1.example.com.", "ns2.example.com."}},
+		// a name with records below it exists
+		{"foo.acme.example.com.", mdns.TypeTXT, mdns.RcodeSuccess, nil},
+		{"_acme-challenge.foo.acme.example.com.", mdns.TypeA, mdns.RcodeSuccess, nil},
+		{"missing.acme.example.com.", mdns.TypeTXT, mdns.RcodeNameError, nil},
+		{"_acme-challenge.example.org.", mdns.TypeTXT, mdns.RcodeRefused, nil},
+	}
+	for _, tt := range tests {
+		msg := new(mdns.Msg)
+		msg.SetQuestion(tt.name, tt.qtype)
+		resp, err := mdns.Exchange(msg, addr)
+		if err != nil {
+			t.Fatalf("%s %s: %s", tt.name, mdns.TypeToString[tt.qtype], err)
+		}
+		query := tt.name + " " + mdns.TypeToString[tt.qtype]
+		if resp.Rcode != tt.rcode {
+			t.Errorf("%s: expected %s, got %s", query, mdns.RcodeToString[tt.rcode], mdns.RcodeToString[resp.Rcode])
+			continue
+		}
+		var answer []string
+		for _, rr := range resp.Answer {
+			switch rr := rr.(type) {
+			case *mdns.TXT:
+				answer = append(answer, strings.Join(rr.Txt, ""))
+			case *mdns.SOA:
+				answer = append(answer, rr.Ns)
+			case *mdns.NS:
+				answer = append(answer, rr.Ns)
+			}
+			if rr.Header().Ttl != 30 {
+				t.Errorf("%s: expected ttl 30, got %d", query, rr.Header().Ttl)
+			}
+		}
+		if strings.Join(answer, ",") != strings.Join(tt.answer, ",") {
+			t.Errorf("%s: expected %q, got %q", query, tt.answer, answer)
+		}
+		if tt.rcode != mdns.RcodeRefused && !resp.Authoritative {
+			t.Errorf("%s: expected an authoritative answer", query)
+		}
+		if len(resp.Answer) == 0 && tt.rcode != mdns.RcodeRefused && len(resp.Ns) != 1 {
+			t.Errorf("%s: expected SOA in authority section, got %v", query, resp.Ns)
+		}
+	}
+}
+
+func TestListenConflict(t *testing.T) {
+	for _, tt := range []struct {
+		a, b     string
+		conflict bool
+	}{
+		{":53", ":53", true},
+		{":53", "0.0.0.0:53", true},
+		{"127.0.0.1:53", ":53", true},
+		{"127.0.0.1:53", "127.0.0.2:53", false},
+		{":53", ":5353", false},
+		{"127.0.0.1:0", "127.0.0.1:0", false},
+	} {
+		if conflict := sameListenAddress(tt.a, tt.b); conflict != tt.conflict {
+			t.Errorf("%s and %s: expected conflict %t, got %t", tt.a, tt.b, tt.conflict, conflict)
+		}
+	}
+
+	c := &Config{
+		Providers: []*DNSProvider{{Zone: "acme.example.com", Provider: "authoritative"}},
+		Users:     []*User{{Name: "alice", Token: "alice123"}},
+		Authoritative: AuthoritativeConfig{
+			Nameservers: []string{"ns1.example.com"},
+		},
+		RFC2136: RFC2136Config{
+			Enabled: true,
+			Keys:    []*TSIGKey{{Name: "key.", Secret: "c2VjcmV0", User: "alice"}},
+		},
+	}
+	if _, err := c.NewServer(); err == nil || !strings.Contains(err.Error(), "conflict") {
+		t.Errorf("expected a conflict of default addresses, got %v", err)
+	}
+	c.RFC2136.Listen = ":5353"
+	if _, err := c.NewServer(); err != nil {
+		t.Error(err)
+	}
+}
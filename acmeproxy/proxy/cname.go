@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	mdns "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+)
+
+const defaultCNAMEMaxDepth = 8
+
+type CNAMEConfig struct {
+	// Enabled turns on cname following globally, users still need followCNAME
+	Enabled bool `yaml:"enabled"`
+	// Resolver is the recursive resolver to ask, e.g. 1.1.1.1:53
+	// defaults to the first nameserver in /etc/resolv.conf
+	Resolver string `yaml:"resolver"`
+	// MaxDepth is the maximum number of cname hops to follow
+	MaxDepth int `yaml:"maxDepth"`
+}
+
+type cnameResolver struct {
+	client   *mdns.Client
+	server   string
+	maxDepth int
+}
+
+func (c *CNAMEConfig) toResolver() (*cnameResolver, error) {
+	server := c.Resolver
+	if server == "" {
+		conf, err := mdns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, errors.Wrap(err, "no resolver configured and unable to read /etc/resolv.conf")
+		}
+		if len(conf.Servers) == 0 {
+			return nil, fmt.Errorf("no resolver configured and no nameserver found in /etc/resolv.conf")
+		}
+		server = net.JoinHostPort(conf.Servers[0], conf.Port)
+	} else if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	maxDepth := c.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultCNAMEMaxDepth
+	}
+
+	return &cnameResolver{
+		client:   &mdns.Client{},
+		server:   server,
+		maxDepth: maxDepth,
+	}, nil
+}
+
+// resolve follows the cname chain starting at fqdn and returns the final target.
+// If fqdn is not a cname, it is returned as is.
+func (r *cnameResolver) resolve(ctx context.Context, fqdn string) (string, error) {
+	seen := make(map[string]bool)
+	name := fqdn
+	for depth := 0; ; depth++ {
+		key := strings.ToLower(name)
+		if seen[key] {
+			return "", fmt.Errorf("cname loop detected at %q while resolving %q", name, fqdn)
+		}
+		seen[key] = true
+
+		target, err := r.lookup(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if target == "" {
+			return name, nil
+		}
+		if depth+1 > r.maxDepth {
+			return "", fmt.Errorf("cname chain of %q exceeds max depth %d", fqdn, r.maxDepth)
+		}
+		name = target
+	}
+}
+
+// lookup returns the cname target of name, or an empty string if there is none.
+func (r *cnameResolver) lookup(ctx context.Context, name string) (string, error) {
+	msg := new(mdns.Msg)
+	msg.SetQuestion(mdns.Fqdn(name), mdns.TypeCNAME)
+	msg.RecursionDesired = true
+
+	resp, _, err := r.client.ExchangeContext(ctx, msg, r.server)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to query cname of %q from %s", name, r.server)
+	}
+	if resp.Rcode != mdns.RcodeSuccess && resp.Rcode != mdns.RcodeNameError {
+		return "", fmt.Errorf("unable to query cname of %q from %s: %s", name, r.server, mdns.RcodeToString[resp.Rcode])
+	}
+
+	for _, rr := range resp.Answer {
+		if cname, ok := rr.(*mdns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, mdns.Fqdn(name)) {
+			return strings.TrimSuffix(cname.Target, "."), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	mdns "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"strings"
+	"testing"
+)
+
+// startCNAMEServer answers CNAME queries from cnames, a map of name to target without trailing dots
+func startCNAMEServer(t *testing.T, cnames map[string]string) string {
+	return startDNS(t, func(w mdns.ResponseWriter, req *mdns.Msg) {
+		resp := new(mdns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		if target, ok := cnames[strings.TrimSuffix(strings.ToLower(q.Name), ".")]; ok {
+			resp.Answer = append(resp.Answer, &mdns.CNAME{
+				Hdr:    mdns.RR_Header{Name: q.Name, Rrtype: mdns.TypeCNAME, Class: mdns.ClassINET, Ttl: 60},
+				Target: mdns.Fqdn(target),
+			})
+		} else {
+			resp.Rcode = mdns.RcodeNameError
+		}
+		_ = w.WriteMsg(resp)
+	})
+}
+
+func TestCNAMEResolve(t *testing.T) {
+	addr := startCNAMEServer(t, map[string]string{
+		"a.example.org":     "b.example.org",
+		"b.example.org":     "c.example.com",
+		"loop1.example.org": "loop2.example.org",
+		"loop2.example.org": "LOOP1.example.org",
+		"d1.example.org":    "d2.example.org",
+		"d2.example.org":    "d3.example.org",
+		"d3.example.org":    "d4.example.org",
+	})
+	resolver, err := (&CNAMEConfig{Resolver: addr, MaxDepth: 2}).toResolver()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		target string
+		err    string
+	}{
+		{"none.example.org", "none.example.org", ""},
+		{"a.example.org", "c.example.com", ""},
+		{"loop1.example.org", "", "cname loop detected"},
+		{"d1.example.org", "", "exceeds max depth 2"},
+	} {
+		target, err := resolver.resolve(context.Background(), tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || target != tt.target {
+			t.Errorf("%s: expected %q, got %q, %v", tt.name, tt.target, target, err)
+		}
+	}
+}
+
+func TestCNAMEAuthorize(t *testing.T) {
+	addr := startCNAMEServer(t, map[string]string{
+		"_acme-challenge.foo.example.org":  "_acme-challenge.foo.example.com",
+		"_acme-challenge.bar.example.org":  "_acme-challenge.bar.example.net",
+		"_acme-challenge.loop.example.org": "_acme-challenge.loop.example.org",
+	})
+	server := newTestServer(t, fmt.Sprintf(`
+cname:
+  enabled: true
+  resolver: %s
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+  - zone: example.net
+    provider: memory
+    config: {}
+users:
+  - name: follower
+    token: abc123
+    followCNAME: true
+    allowedZones:
+      - zone: foo.example.com
+  - name: direct
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+`, addr))
+
+	for _, tt := range []struct {
+		user string
+		fqdn string
+		// name of the record, empty if not allowed
+		name string
+		err  error
+	}{
+		{"follower", "_acme-challenge.foo.example.org.", "_acme-challenge.foo.example.com", nil},
+		{"follower", "_acme-challenge.foo.example.com", "_acme-challenge.foo.example.com", nil},
+		// the target is authorized, not the requested name
+		{"follower", "_acme-challenge.bar.example.org", "", ErrDomainNotAllowed},
+		{"follower", "_acme-challenge.loop.example.org", "", ErrCNAME},
+		// cname is only followed for users with followCNAME
+		{"direct", "_acme-challenge.foo.example.org", "", ErrDomainNotAllowed},
+	} {
+		act, err := server.authorize(context.Background(), tt.user, tt.fqdn, "value")
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s %s: expected %v, got %v", tt.user, tt.fqdn, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %s", tt.user, tt.fqdn, err)
+			continue
+		}
+		if act.request.Name != tt.name || act.provider.zone != "example.com" {
+			t.Errorf("%s %s: expected %s in example.com, got %s in %s", tt.user, tt.fqdn, tt.name, act.request.Name, act.provider.zone)
+		}
+	}
+}
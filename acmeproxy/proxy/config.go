@@ -1,38 +1,94 @@
 package proxy
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	"os"
 	"path/filepath"
 	"slices"
+	"sync"
 )
 
 type Config struct {
 	Server    string         `yaml:"server"`
 	Users     []*User        `yaml:"users"`
 	Providers []*DNSProvider `yaml:"providers"`
+	CNAME     CNAMEConfig    `yaml:"cname"`
+	Health    HealthConfig   `yaml:"health"`
 
+	Authoritative AuthoritativeConfig `yaml:"authoritative"`
+	AcmeDNS       AcmeDNSConfig       `yaml:"acmeDNS"`
+	RFC2136       RFC2136Config       `yaml:"rfc2136"`
+
+	// mu guards providerZoneMap against zone discovery refresh
+	mu              sync.RWMutex
 	userMap         map[string]*User
 	providerZoneMap map[string]*Provider
 }
 
 func (c *Config) CreateServer() *Server {
+	server, err := c.NewServer()
+	if err != nil {
+		panic(err)
+	}
+	return server
+}
+
+// NewServer creates providers and users of the config, and a Server using them.
+func (c *Config) NewServer() (*Server, error) {
 	savedErrors := c.loadAllProvider()
 	if checkSavedErrors(savedErrors) {
-		panic("error creating providers")
+		return nil, errors.New("error creating providers")
 	}
 
 	savedErrors = c.loadAllUser()
 	if checkSavedErrors(savedErrors) {
-		panic("error creating users")
+		return nil, errors.New("error creating users")
 	}
 
-	return &Server{
+	server := &Server{
 		users:  c.userMap,
 		config: c,
 	}
+	if c.CNAME.Enabled {
+		resolver, err := c.CNAME.toResolver()
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating cname resolver")
+		}
+		logrus.Infof("following cname with resolver %s, max depth %d", resolver.server, resolver.maxDepth)
+		server.cname = resolver
+	}
+	if c.Health.Providers {
+		server.checker = newProviderChecker(c)
+	}
+	authoritative, err := newAuthoritativeServer(c)
+	if err != nil {
+		return nil, err
+	}
+	server.authoritative = authoritative
+	if c.AcmeDNS.Enabled {
+		server.acmeDNS, err = newAcmeDNS(server, &c.AcmeDNS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.RFC2136.Enabled {
+		server.rfc2136, err = newRFC2136Server(server, &c.RFC2136)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if server.authoritative != nil && server.rfc2136 != nil && sameListenAddress(server.authoritative.listen, server.rfc2136.listen) {
+		return nil, errors.Errorf("authoritative.listen %q and rfc2136.listen %q conflict, set a different address for one of them",
+			server.authoritative.listen, server.rfc2136.listen)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server.stop = cancel
+	c.startDiscovery(ctx)
+	return server, nil
 }
 
 func loadConfig() *Config {
@@ -41,30 +97,42 @@ func loadConfig() *Config {
 	if path == "" {
 		path = "./config.yaml"
 	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+// LoadConfig reads the config file at path.
+func LoadConfig(path string) (*Config, error) {
 	path, err := filepath.Abs(path)
 	if err != nil {
-		panic(errors.Wrapf(err, "unable to locate configfile"))
+		return nil, errors.Wrapf(err, "unable to locate configfile")
 	}
 
 	logrus.Infof("using config file at %q", path)
 	content, err := os.ReadFile(path)
 	if err != nil {
-		panic(errors.Wrapf(err, "unable to open config file %q", path))
+		return nil, errors.Wrapf(err, "unable to open config file %q", path)
 	}
 	config := &Config{}
 	err = yaml.Unmarshal(content, config)
 	if err != nil {
-		panic(errors.Wrap(err, "error unmarshalling config"))
+		return nil, errors.Wrap(err, "error unmarshalling config")
 	}
 
 	logrus.Infof("found %d users", len(config.Users))
 	logrus.Infof("found %d providers", len(config.Providers))
-	return config
+	return config, nil
 }
 
 func (c *Config) loadAllProvider() (savedErrors []error) {
 	c.providerZoneMap = make(map[string]*Provider)
 	for _, spec := range c.Providers {
+		if spec.Discover != nil {
+			continue
+		}
 		provider, err := spec.ToProvider()
 		if err != nil {
 			savedErrors = append(savedErrors, errors.Wrapf(err, "error creating provider %q", spec))
@@ -72,6 +140,21 @@ func (c *Config) loadAllProvider() (savedErrors []error) {
 		}
 		c.providerZoneMap[provider.zone] = provider
 	}
+
+	// discover after static providers, so they take precedence
+	for _, spec := range c.Providers {
+		if spec.Discover == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		providers, err := spec.discoverProviders(ctx)
+		cancel()
+		if err != nil {
+			savedErrors = append(savedErrors, errors.Wrapf(err, "error discovering zones of %q", spec))
+			continue
+		}
+		logrus.Infof("discovered %d zones of %q", c.addDiscovered(providers), spec)
+	}
 	return savedErrors
 }
 
@@ -92,7 +175,9 @@ func (c *Config) checkUnusedProvider() {
 	var providerInUse []string
 	for _, user := range c.userMap {
 		for _, zone := range user.AllowedZones {
-			providerInUse = append(providerInUse, zone.provider.String())
+			if provider := zone.provider.Load(); provider != nil {
+				providerInUse = append(providerInUse, provider.String())
+			}
 		}
 	}
 
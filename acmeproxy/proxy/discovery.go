@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/libdns/libdns"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const discoveryTimeout = time.Minute
+
+type ZoneDiscovery struct {
+	// Include is a list of regex, a zone is discovered if it matches any of them,
+	// all zones are included if empty
+	Include []string `yaml:"include"`
+	// Exclude is a list of regex, a zone is skipped if it matches any of them
+	Exclude []string `yaml:"exclude"`
+	// Refresh is the interval to list zones again, e.g. 10m, disabled if zero
+	Refresh time.Duration `yaml:"refresh"`
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func (z *ZoneDiscovery) init() (err error) {
+	z.include, err = compileAll(z.Include)
+	if err != nil {
+		return errors.Wrap(err, "invalid include filter")
+	}
+	z.exclude, err = compileAll(z.Exclude)
+	if err != nil {
+		return errors.Wrap(err, "invalid exclude filter")
+	}
+	return nil
+}
+
+func (z *ZoneDiscovery) match(zone string) bool {
+	for _, r := range z.exclude {
+		if r.MatchString(zone) {
+			return false
+		}
+	}
+	if len(z.include) == 0 {
+		return true
+	}
+	for _, r := range z.include {
+		if r.MatchString(zone) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, expr := range exprs {
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to compile regex %q", expr)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// discoverProviders lists zones from the provider and creates a Provider for each zone passing the filters.
+func (d *DNSProvider) discoverProviders(ctx context.Context) ([]*Provider, error) {
+	if d.dnsProvider == nil {
+		if d.Zone != "" {
+			return nil, fmt.Errorf("zone %q must be empty when discover is set", d.Zone)
+		}
+		if err := d.Discover.init(); err != nil {
+			return nil, err
+		}
+		dnsProvider, err := d.newDNSProvider()
+		if err != nil {
+			return nil, err
+		}
+		d.dnsProvider = dnsProvider
+	}
+
+	lister, ok := d.dnsProvider.(libdns.ZoneLister)
+	if !ok {
+		return nil, fmt.Errorf("provider %q does not support listing zones", d.Provider)
+	}
+	zones, err := lister.ListZones(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list zones of %q", d)
+	}
+
+	var providers []*Provider
+	for _, zone := range zones {
+		name := strings.TrimSuffix(zone.Name, ".")
+		if !d.Discover.match(name) {
+			logrus.Debugf("skipping discovered zone %q of %q", name, d)
+			continue
+		}
+		provider := d.newProvider(name, d.dnsProvider)
+		provider.discoveredBy = d
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// addDiscovered adds discovered providers to providerZoneMap,
+// statically configured zones always take precedence.
+func (c *Config) addDiscovered(providers []*Provider) (added int) {
+	for _, provider := range providers {
+		if exist, ok := c.providerZoneMap[provider.zone]; ok {
+			logrus.Warnf("discovered zone %q is already provided by %q, skipping", provider.zone, exist)
+			continue
+		}
+		c.providerZoneMap[provider.zone] = provider
+		added++
+	}
+	return added
+}
+
+// startDiscovery refreshes discovered zones in the background until ctx is done.
+func (c *Config) startDiscovery(ctx context.Context) {
+	for _, spec := range c.Providers {
+		if spec.Discover == nil || spec.Discover.Refresh <= 0 {
+			continue
+		}
+		go c.refreshLoop(ctx, spec)
+	}
+}
+
+func (c *Config) refreshLoop(ctx context.Context, spec *DNSProvider) {
+	ticker := time.NewTicker(spec.Discover.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := c.refreshDiscovered(ctx, spec)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("error refreshing zones of %q: %s", spec, err)
+		}
+	}
+}
+
+// refreshDiscovered replaces zones discovered by spec with a fresh list and rebinds users.
+func (c *Config) refreshDiscovered(ctx context.Context, spec *DNSProvider) error {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	providers, err := spec.discoverProviders(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for zone, provider := range c.providerZoneMap {
+		if provider.discoveredBy == spec {
+			delete(c.providerZoneMap, zone)
+		}
+	}
+	added := c.addDiscovered(providers)
+	for _, user := range c.userMap {
+		err := user.bind(c.providerZoneMap)
+		if err != nil {
+			logrus.Warnf("unable to bind user %q after refreshing zones of %q: %s", user.Name, spec, err)
+		}
+	}
+	logrus.Debugf("refreshed %d zones of %q", added, spec)
+	return nil
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"acmeproxy/dns"
+	"context"
+	"github.com/libdns/libdns"
+	"github.com/pkg/errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// zoneListerProvider is a memory provider listing zones which can be changed by the test
+type zoneListerProvider struct {
+	*dns.MemoryProvider
+
+	mu    sync.Mutex
+	zones []string
+	lists int
+}
+
+func (z *zoneListerProvider) ListZones(context.Context) ([]libdns.Zone, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.lists++
+	var zones []libdns.Zone
+	for _, zone := range z.zones {
+		zones = append(zones, libdns.Zone{Name: zone + "."})
+	}
+	return zones, nil
+}
+
+func (z *zoneListerProvider) listCount() int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.lists
+}
+
+func (z *zoneListerProvider) setZones(zones ...string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.zones = zones
+}
+
+func TestDiscovery(t *testing.T) {
+	lister := &zoneListerProvider{MemoryProvider: dns.NewMemoryProvider()}
+	lister.setZones("example.com", "sub.example.com", "internal.example.com", "example.org")
+	dns.Register("test-zone-lister", func() dns.Provider {
+		return lister
+	})
+	server := newTestServer(t, `
+providers:
+  - provider: test-zone-lister
+    config: {}
+    discover:
+      exclude:
+        - ^internal\.
+users:
+  - name: example
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+      - zone: foo.sub.example.com
+      - zone: foo.internal.example.com
+      - zone: foo.example.org
+`)
+
+	expectZone := func(fqdn, zone string) {
+		t.Helper()
+		act, err := server.authorize(context.Background(), "example", fqdn, "value")
+		if zone == "" {
+			if !errors.Is(err, ErrDomainNotAllowed) {
+				t.Errorf("%s: expected ErrDomainNotAllowed, got %v", fqdn, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", fqdn, err)
+			return
+		}
+		if act.provider.zone != zone {
+			t.Errorf("%s: expected zone %s, got %s", fqdn, zone, act.provider.zone)
+		}
+	}
+
+	if _, ok := server.config.providerZoneMap["internal.example.com"]; ok {
+		t.Error("excluded zone internal.example.com discovered")
+	}
+	// nested zones bind to the longest one
+	expectZone("_acme-challenge.foo.example.com", "example.com")
+	expectZone("_acme-challenge.foo.sub.example.com", "sub.example.com")
+	// the excluded zone is managed through its parent
+	expectZone("_acme-challenge.foo.internal.example.com", "example.com")
+	expectZone("_acme-challenge.foo.example.org", "example.org")
+
+	spec := server.config.Providers[0]
+	lister.setZones("example.com", "internal.example.com")
+	if err := server.config.refreshDiscovered(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	expectZone("_acme-challenge.foo.sub.example.com", "example.com")
+	// a zone which is gone is unbound
+	expectZone("_acme-challenge.foo.example.org", "")
+
+	lister.setZones("example.com", "sub.example.com", "example.org")
+	if err := server.config.refreshDiscovered(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	expectZone("_acme-challenge.foo.sub.example.com", "sub.example.com")
+	expectZone("_acme-challenge.foo.example.org", "example.org")
+}
+
+func TestDiscoveryStaticPrecedence(t *testing.T) {
+	lister := &zoneListerProvider{MemoryProvider: dns.NewMemoryProvider()}
+	lister.setZones("example.com")
+	dns.Register("test-zone-lister", func() dns.Provider {
+		return lister
+	})
+	server := newTestServer(t, `
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+  - provider: test-zone-lister
+    config: {}
+    discover: {}
+users:
+  - name: example
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+`)
+	if provider := server.config.providerZoneMap["example.com"]; provider.discoveredBy != nil {
+		t.Errorf("expected static provider of example.com, got %s", provider)
+	}
+}
+
+func TestDiscoveryRefreshStops(t *testing.T) {
+	lister := &zoneListerProvider{MemoryProvider: dns.NewMemoryProvider()}
+	lister.setZones("example.com")
+	dns.Register("test-zone-lister", func() dns.Provider {
+		return lister
+	})
+	server := newTestServer(t, `
+providers:
+  - provider: test-zone-lister
+    config: {}
+    discover:
+      refresh: 10ms
+users:
+  - name: example
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+`)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lister.listCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected zones refreshed, got %d lists", lister.listCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.Close()
+	// a refresh running while closing may still finish
+	time.Sleep(50 * time.Millisecond)
+	closed := lister.listCount()
+	time.Sleep(100 * time.Millisecond)
+	if lists := lister.listCount(); lists != closed {
+		t.Errorf("expected no refresh after close, got %d lists after %d", lists, closed)
+	}
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthTimeout     = 10 * time.Second
+	defaultHealthCacheTTL    = time.Minute
+	defaultHealthConcurrency = 4
+)
+
+type HealthConfig struct {
+	// Providers enables /healthz/providers, which calls GetRecords on each provider
+	Providers bool `yaml:"providers"`
+	// Timeout of each provider check, default 10s
+	Timeout time.Duration `yaml:"timeout"`
+	// CacheTTL is how long a check result is reused, default 1m
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+	// Concurrency is the maximum number of providers checked at once, default 4
+	Concurrency int `yaml:"concurrency"`
+}
+
+type ProviderHealth struct {
+	Provider string `json:"provider"`
+	Zone     string `json:"zone"`
+	Healthy  bool   `json:"healthy"`
+	Latency  int64  `json:"latencyMs"`
+}
+
+type ProvidersHealthResponse struct {
+	Success   bool      `json:"success"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Healthy and Failing count all providers
+	Healthy int `json:"healthy"`
+	Failing int `json:"failing"`
+	// Providers are only listed for an authenticated user, limited to providers of the user's allowed zones
+	Providers []*ProviderHealth `json:"providers,omitempty"`
+}
+
+// healthResult is a check of all providers, health[i] is the health of providers[i]
+type healthResult struct {
+	checkedAt time.Time
+	providers []*Provider
+	health    []*ProviderHealth
+}
+
+// providerChecker checks connectivity of all providers and caches the result.
+type providerChecker struct {
+	config      *Config
+	timeout     time.Duration
+	cacheTTL    time.Duration
+	concurrency int
+
+	// mu is held during a check, so concurrent requests wait for the same result
+	mu   sync.Mutex
+	last *healthResult
+}
+
+func newProviderChecker(c *Config) *providerChecker {
+	checker := &providerChecker{
+		config:      c,
+		timeout:     c.Health.Timeout,
+		cacheTTL:    c.Health.CacheTTL,
+		concurrency: c.Health.Concurrency,
+	}
+	if checker.timeout <= 0 {
+		checker.timeout = defaultHealthTimeout
+	}
+	if checker.cacheTTL <= 0 {
+		checker.cacheTTL = defaultHealthCacheTTL
+	}
+	if checker.concurrency <= 0 {
+		checker.concurrency = defaultHealthConcurrency
+	}
+	return checker
+}
+
+func (p *providerChecker) check() *healthResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && time.Since(p.last.checkedAt) < p.cacheTTL {
+		return p.last
+	}
+
+	providers := p.config.providers()
+	result := &healthResult{
+		checkedAt: time.Now(),
+		providers: providers,
+		health:    make([]*ProviderHealth, len(providers)),
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, p.concurrency)
+	for i, provider := range providers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, provider *Provider) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result.health[i] = p.checkProvider(provider)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	p.last = result
+	return result
+}
+
+// response counts healthy and failing providers, and lists providers of user if it is not nil.
+func (r *healthResult) response(user *User) *ProvidersHealthResponse {
+	response := &ProvidersHealthResponse{CheckedAt: r.checkedAt}
+	var allowed map[*Provider]bool
+	if user != nil {
+		allowed = make(map[*Provider]bool)
+		for _, provider := range user.providers() {
+			allowed[provider] = true
+		}
+		response.Providers = []*ProviderHealth{}
+	}
+	for i, health := range r.health {
+		if health.Healthy {
+			response.Healthy++
+		} else {
+			response.Failing++
+		}
+		if allowed[r.providers[i]] {
+			response.Providers = append(response.Providers, health)
+		}
+	}
+	response.Success = response.Failing == 0
+	return response
+}
+
+func (p *providerChecker) checkProvider(provider *Provider) *ProviderHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := provider.provider.GetRecords(ctx, provider.zone)
+	health := &ProviderHealth{
+		Provider: provider.name,
+		Zone:     provider.zone,
+		Healthy:  err == nil,
+		Latency:  time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		// the endpoint is not authenticated, errors may contain api hosts or account ids, so they are only logged
+		logrus.Warnf("health check of %q failed: %s", provider, err)
+	}
+	return health
+}
+
+// providers returns a snapshot of all providers sorted by zone.
+func (c *Config) providers() []*Provider {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	providers := make([]*Provider, 0, len(c.providerZoneMap))
+	for _, provider := range c.providerZoneMap {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].zone < providers[j].zone
+	})
+	return providers
+}
+
+// Healthz reports the process is alive.
+func (s *Server) Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Readyz reports the config is loaded and the listener is up.
+func (s *Server) Readyz(ctx *gin.Context) {
+	if !s.ready.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"success": false})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ProvidersHealth reports how many providers are healthy, without authentication,
+// and the health of each provider of the user's allowed zones, if the request has basic auth.
+func (s *Server) ProvidersHealth(ctx *gin.Context) {
+	var user *User
+	if _, _, ok := ctx.Request.BasicAuth(); ok {
+		s.basicAuth(ctx)
+		if ctx.IsAborted() {
+			return
+		}
+		user = s.users[ctx.MustGet(gin.AuthUserKey).(string)]
+	}
+
+	response := s.checker.check().response(user)
+	status := http.StatusOK
+	if !response.Success {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, response)
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"acmeproxy/dns"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/libdns/libdns"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	server := newTestServer(t, `
+health:
+  providers: true
+  cacheTTL: 1h
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+  - zone: example.net
+    provider: memory
+    config:
+      error_rate: 1
+users:
+  - name: example
+    token: abc123
+    allowedZones:
+      - zone: foo.example.com
+      - zone: foo.example.net
+  - name: other
+    token: abc123
+    allowedZones:
+      - zone: bar.example.com
+`)
+	router := server.Router()
+
+	if status, _ := serve(t, router, http.MethodGet, "/healthz", "", "", ""); status != http.StatusOK {
+		t.Errorf("healthz: expected 200, got %d", status)
+	}
+	if status, _ := serve(t, router, http.MethodGet, "/readyz", "", "", ""); status != http.StatusServiceUnavailable {
+		t.Errorf("readyz before serving: expected 503, got %d", status)
+	}
+	server.ready.Store(true)
+	if status, _ := serve(t, router, http.MethodGet, "/readyz", "", "", ""); status != http.StatusOK {
+		t.Errorf("readyz: expected 200, got %d", status)
+	}
+
+	providersHealth := func(user, token string) (int, *ProvidersHealthResponse, string) {
+		t.Helper()
+		status, body := serve(t, router, http.MethodGet, "/healthz/providers", user, token, "")
+		var response ProvidersHealthResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatal(err)
+		}
+		return status, &response, body
+	}
+
+	// without authentication, only the counts are reported
+	status, response, body := providersHealth("", "")
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("healthz/providers: expected 503, got %d", status)
+	}
+	if strings.Contains(body, "injected") || strings.Contains(body, "example") {
+		t.Errorf("healthz/providers exposes zones or the provider error: %s", body)
+	}
+	if response.Success || response.Healthy != 1 || response.Failing != 1 || response.Providers != nil {
+		t.Errorf("expected 1 healthy and 1 failing provider, got %s", body)
+	}
+
+	// the result is cached
+	if _, _, again := providersHealth("", ""); again != body {
+		t.Errorf("expected cached result %s, got %s", body, again)
+	}
+
+	// an authenticated user sees providers of its allowed zones
+	_, response, body = providersHealth("example", "abc123")
+	if response.Success || len(response.Providers) != 2 ||
+		!response.Providers[0].Healthy || response.Providers[0].Zone != "example.com" ||
+		response.Providers[1].Healthy || response.Providers[1].Zone != "example.net" {
+		t.Errorf("expected example.com healthy and example.net failing, got %s", body)
+	}
+	_, response, body = providersHealth("other", "abc123")
+	if response.Failing != 1 || len(response.Providers) != 1 || response.Providers[0].Zone != "example.com" {
+		t.Errorf("expected only example.com listed, got %s", body)
+	}
+	if status, _, _ := providersHealth("other", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", status)
+	}
+}
+
+// concurrencyProvider is a memory provider recording the maximum number of concurrent GetRecords
+type concurrencyProvider struct {
+	*dns.MemoryProvider
+
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrencyProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	c.mu.Lock()
+	c.current++
+	c.max = max(c.max, c.current)
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	c.current--
+	c.mu.Unlock()
+	return c.MemoryProvider.GetRecords(ctx, zone)
+}
+
+func TestProvidersHealthConcurrency(t *testing.T) {
+	provider := &concurrencyProvider{MemoryProvider: dns.NewMemoryProvider()}
+	dns.Register("test-concurrency", func() dns.Provider {
+		return provider
+	})
+	config := "health:\n  providers: true\n  concurrency: 2\nproviders:\n"
+	for i := range 6 {
+		config += fmt.Sprintf("  - zone: example%d.com\n    provider: test-concurrency\n    config: {}\n", i)
+	}
+	server := newTestServer(t, config+"users: []\n")
+
+	if response := server.checker.check().response(nil); response.Healthy != 6 {
+		t.Errorf("expected 6 healthy providers, got %+v", response)
+	}
+	if provider.max != 2 {
+		t.Errorf("expected at most 2 concurrent checks, got %d", provider.max)
+	}
+}
+
+func TestProvidersHealthDisabled(t *testing.T) {
+	router := newTestServer(t, `
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+users: []
+`).Router()
+	if status, _ := serve(t, router, http.MethodGet, "/healthz/providers", "", "", ""); status != http.StatusNotFound {
+		t.Errorf("expected 404 without health.providers, got %d", status)
+	}
+}
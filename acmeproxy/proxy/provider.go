@@ -9,47 +9,140 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"strings"
+	"sync"
 )
 
+var ErrRecordNotFound = errors.New("record not found")
+
 type DNSProvider struct {
-	Zone     string         `yaml:"zone" validate:"required"`
+	Zone     string         `yaml:"zone" validate:"required_without=Discover"`
 	Provider string         `yaml:"provider" validate:"required"`
 	Config   map[string]any `yaml:"config" validate:"required"`
+	// Discover lists zones from the provider instead of using Zone
+	Discover *ZoneDiscovery `yaml:"discover"`
+	// AppendOnly presents with AppendRecords even if the provider can set records,
+	// for providers whose SetRecords does not keep other values of a name
+	AppendOnly bool `yaml:"appendOnly"`
+	// StrictConfig fails on unknown properties of Config instead of warning about them
+	StrictConfig bool `yaml:"strictConfig"`
+
+	// dnsProvider is shared by all zones discovered by this spec
+	dnsProvider dns.Provider
 }
 
 type Provider struct {
 	zone     string
 	name     string
 	provider dns.Provider
+	// setter is provider if it can set records and it is allowed to, nil otherwise
+	setter libdns.RecordSetter
+	// setMu serializes reading and setting records of the zone
+	setMu sync.Mutex
+
+	// discoveredBy is the spec which discovered this zone, nil if configured statically
+	discoveredBy *DNSProvider
 }
 
 func (d *DNSProvider) ToProvider() (*Provider, error) {
 	// setup env for config
 	logrus.Infof("creating provider %q", d)
 
+	dnsProvider, err := d.newDNSProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.newProvider(d.Zone, dnsProvider), nil
+}
+
+// newProvider creates a Provider of a zone, detecting optional capabilities of dnsProvider
+func (d *DNSProvider) newProvider(zone string, dnsProvider dns.Provider) *Provider {
+	p := &Provider{
+		zone:     zone,
+		name:     d.Provider,
+		provider: dnsProvider,
+	}
+	if setter, ok := dnsProvider.(libdns.RecordSetter); ok && !d.AppendOnly {
+		p.setter = setter
+	}
+	return p
+}
+
+func (d *DNSProvider) newDNSProvider() (dns.Provider, error) {
 	cfgJson, err := json.Marshal(d.Config)
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to marshal config for %q", d)
 	}
 
+	schema, err := dns.ProviderSchema(d.Provider)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create %q", d)
+	}
+	var config any
+	if err := json.Unmarshal(cfgJson, &config); err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal config for %q", d)
+	}
+	unknown, err := schema.Validate(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config for %q", d)
+	}
+	if len(unknown) > 0 {
+		if d.StrictConfig {
+			return nil, errors.Errorf("invalid config for %q: unknown properties %q", d, unknown)
+		}
+		// the provider ignores them, e.g. a misspelled key or one of a newer version of the provider
+		logrus.Warnf("config of %q has unknown properties %q, they are ignored", d, unknown)
+	}
+
 	dnsProvider := dns.NewProviderByNameWithConfig(d.Provider, cfgJson)
 	if dnsProvider == nil {
 		return nil, fmt.Errorf("unable to obtain config for %q", d)
 	}
-
-	return &Provider{
-		zone:     d.Zone,
-		name:     d.Provider,
-		provider: dnsProvider,
-	}, nil
+	return dnsProvider, nil
 }
 
+// Present creates a TXT record, it is not created again if it exists already, and returns it.
+// If the provider can set records, the existing values of the name are set together with the new one,
+// so a provider replacing the whole set of a name keeps them.
+// Reading and setting the values is serialized by setMu in this process only, so the set path assumes
+// acmeproxy is the single writer of the name: another acmeproxy instance or another tool changing it
+// at the same time may lose values, use appendOnly for such a provider.
 func (p *Provider) Present(ctx context.Context, record libdns.Record) ([]libdns.Record, error) {
-	records, err := p.provider.AppendRecords(ctx, p.zone, []libdns.Record{record})
+	if p.setter == nil {
+		records, err := p.provider.AppendRecords(ctx, p.zone, []libdns.Record{record})
+		if err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	p.setMu.Lock()
+	defer p.setMu.Unlock()
+	records, err := p.provider.GetRecords(ctx, p.zone)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "%q could not get records", p)
 	}
-	return records, nil
+	var values []libdns.Record
+	for _, r := range records {
+		if r.Type != record.Type || p.fqdn(r.Name) != record.Name {
+			continue
+		}
+		if r.Value == record.Value {
+			return []libdns.Record{r}, nil
+		}
+		values = append(values, r)
+	}
+	records, err = p.setter.SetRecords(ctx, p.zone, append(values, record))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%q could not set records", p)
+	}
+	// the set records include the existing values, only the presented one is returned
+	for _, r := range records {
+		if r.Type == record.Type && p.fqdn(r.Name) == record.Name && r.Value == record.Value {
+			return []libdns.Record{r}, nil
+		}
+	}
+	return []libdns.Record{record}, nil
 }
 func (p *Provider) CleanUp(ctx context.Context, record libdns.Record) ([]libdns.Record, error) {
 	records, err := p.provider.GetRecords(ctx, p.zone)
@@ -77,7 +170,7 @@ func (p *Provider) CleanUp(ctx context.Context, record libdns.Record) ([]libdns.
 		}
 	}
 	if recordToDelete == nil {
-		return nil, fmt.Errorf("%q could not find record to delete", p)
+		return nil, errors.Wrapf(ErrRecordNotFound, "%q could not find record to delete", p)
 	}
 	records, err = p.provider.DeleteRecords(ctx, p.zone, []libdns.Record{*recordToDelete})
 	if err != nil {
@@ -86,10 +179,27 @@ func (p *Provider) CleanUp(ctx context.Context, record libdns.Record) ([]libdns.
 	return records, nil
 
 }
+
+// fqdn converts a record name returned by the provider to a fqdn,
+// libdns names are relative to the zone, but some provider returns a fqdn.
+func (p *Provider) fqdn(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || name == "@" {
+		return p.zone
+	}
+	if name == p.zone || strings.HasSuffix(name, "."+p.zone) {
+		return name
+	}
+	return name + "." + p.zone
+}
+
 func (p *Provider) String() string {
 	return fmt.Sprintf("%s/%s", p.name, p.zone)
 }
 
 func (d *DNSProvider) String() string {
+	if d.Discover != nil {
+		return fmt.Sprintf("%s/<discovered>", d.Provider)
+	}
 	return fmt.Sprintf("%s/%s", d.Provider, d.Zone)
 }
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"acmeproxy/dns"
+	"context"
+	"github.com/libdns/libdns"
+	"strings"
+	"testing"
+)
+
+func TestProviderUnknownConfig(t *testing.T) {
+	spec := &DNSProvider{
+		Zone:     "example.com",
+		Provider: "memory",
+		Config:   map[string]any{"latency": "1ms", "apiToken": "token"},
+	}
+	if _, err := spec.ToProvider(); err != nil {
+		t.Fatalf("expected a config with an unknown key to load, got %s", err)
+	}
+
+	spec.StrictConfig = true
+	if _, err := spec.ToProvider(); err == nil || !strings.Contains(err.Error(), `unknown properties ["config.apiToken"]`) {
+		t.Errorf("expected the unknown key rejected, got %v", err)
+	}
+
+	// a wrong type fails either way
+	spec.StrictConfig = false
+	spec.Config = map[string]any{"latency": true}
+	if _, err := spec.ToProvider(); err == nil || !strings.Contains(err.Error(), "config.latency: expected string, got boolean") {
+		t.Errorf("expected the wrong type rejected, got %v", err)
+	}
+}
+
+// countingSetter is a memory provider counting calls of SetRecords
+type countingSetter struct {
+	*dns.MemoryProvider
+	sets int
+}
+
+func (c *countingSetter) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	c.sets++
+	return c.MemoryProvider.SetRecords(ctx, zone, recs)
+}
+
+func TestProviderPresentSet(t *testing.T) {
+	ctx := context.Background()
+	setter := &countingSetter{MemoryProvider: dns.NewMemoryProvider()}
+	provider := (&DNSProvider{Provider: "memory"}).newProvider("example.com", setter)
+	record := func(value string) libdns.Record {
+		return libdns.Record{Type: "TXT", Name: "_acme-challenge.example.com", Value: value}
+	}
+	_, err := setter.AppendRecords(ctx, "example.com", []libdns.Record{{Type: "TXT", Name: "other", Value: "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := provider.Present(ctx, record("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := provider.Present(ctx, record("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the presented record is returned, not the existing values set with it
+	if len(first) != 1 || first[0].Value != "a" || len(second) != 1 || second[0].Value != "b" {
+		t.Errorf("expected the presented records, got %+v and %+v", first, second)
+	}
+	if setter.sets != 2 {
+		t.Errorf("expected 2 calls of SetRecords, got %d", setter.sets)
+	}
+
+	// an existing value is returned without setting records
+	again, err := provider.Present(ctx, record("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].ID != first[0].ID {
+		t.Errorf("expected the existing record %+v, got %+v", first, again)
+	}
+	if setter.sets != 2 {
+		t.Errorf("expected no call of SetRecords for an existing value, got %d calls", setter.sets)
+	}
+
+	records, err := setter.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, r := range records {
+		values[r.Value] = r.Name
+	}
+	if len(records) != 3 || values["a"] != "_acme-challenge" || values["b"] != "_acme-challenge" || values["other"] != "other" {
+		t.Errorf("expected existing values kept, got %+v", records)
+	}
+
+	// appendOnly does not set records
+	appendOnly := (&DNSProvider{Provider: "memory", AppendOnly: true}).newProvider("example.com", setter)
+	if _, err := appendOnly.Present(ctx, record("c")); err != nil {
+		t.Fatal(err)
+	}
+	if setter.sets != 2 {
+		t.Errorf("expected no call of SetRecords with appendOnly, got %d calls", setter.sets)
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"acmeproxy/dns"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/libdns/libdns"
+	"net/http"
+	"sort"
+)
+
+// Capabilities are names of libdns interfaces
+const (
+	CapabilityGet       = "RecordGetter"
+	CapabilityAppend    = "RecordAppender"
+	CapabilityDelete    = "RecordDeleter"
+	CapabilitySet       = "RecordSetter"
+	CapabilityListZones = "ZoneLister"
+)
+
+type ProviderInfo struct {
+	Zone     string `json:"zone"`
+	Provider string `json:"provider"`
+	// Capabilities are the libdns interfaces the provider implements
+	Capabilities []string `json:"capabilities"`
+	// Present is how records are presented, set or append
+	Present string `json:"present"`
+}
+
+type ProvidersResponse struct {
+	Success   bool            `json:"success"`
+	Providers []*ProviderInfo `json:"providers"`
+}
+
+// capabilities detects optional libdns interfaces of a provider
+func capabilities(p dns.Provider) []string {
+	result := []string{CapabilityGet, CapabilityAppend, CapabilityDelete}
+	if _, ok := p.(libdns.RecordSetter); ok {
+		result = append(result, CapabilitySet)
+	}
+	if _, ok := p.(libdns.ZoneLister); ok {
+		result = append(result, CapabilityListZones)
+	}
+	return result
+}
+
+func (p *Provider) info() *ProviderInfo {
+	present := "append"
+	if p.setter != nil {
+		present = "set"
+	}
+	return &ProviderInfo{
+		Zone:         p.zone,
+		Provider:     p.name,
+		Capabilities: capabilities(p.provider),
+		Present:      present,
+	}
+}
+
+// Providers lists providers of zones the user is allowed to manage, with their capabilities.
+func (s *Server) Providers(ctx *gin.Context) {
+	user := s.users[ctx.MustGet(gin.AuthUserKey).(string)]
+	response := &ProvidersResponse{Success: true, Providers: []*ProviderInfo{}}
+	for _, provider := range user.providers() {
+		response.Providers = append(response.Providers, provider.info())
+	}
+	sort.Slice(response.Providers, func(i, j int) bool {
+		return response.Providers[i].Zone < response.Providers[j].Zone
+	})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ProviderSchema responds the JSON Schema of the config of a provider compiled in,
+// it is not authenticated, as it describes the binary, not the configuration.
+func (s *Server) ProviderSchema(ctx *gin.Context) {
+	name := ctx.Param("name")
+	schema, err := dns.ProviderSchema(name)
+	if err != nil {
+		abortWithError(ctx, ErrNotFound, fmt.Sprintf("provider %q is not compiled in", name))
+		return
+	}
+	ctx.JSON(http.StatusOK, schema)
+}
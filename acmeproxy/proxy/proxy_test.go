@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	mdns "github.com/miekg/dns"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestServer creates a Server from a yaml config, closed when the test finishes
+func newTestServer(t *testing.T, config string) *Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := c.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// startDNS serves handler on a local UDP port, stopped when the test finishes, and returns its address
+func startDNS(t *testing.T, handler mdns.HandlerFunc) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &mdns.Server{PacketConn: conn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return conn.LocalAddr().String()
+}
+
+// serve sends a request to the router with basic auth if user is set, and returns the status and body
+func serve(t *testing.T, router *gin.Engine, method, path, user, token, body string) (int, string) {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if user != "" {
+		req.SetBasicAuth(user, token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code, recorder.Body.String()
+}
+
+// txtValues lists the records of zone with the user's credentials, and returns the sorted values of name
+func txtValues(t *testing.T, router *gin.Engine, user, token, zone, name string) []string {
+	t.Helper()
+	status, body := serve(t, router, http.MethodGet, "/v1/records?zone="+zone, user, token, "")
+	if status != http.StatusOK {
+		t.Fatalf("records of %s: %d %s", zone, status, body)
+	}
+	var response RecordsResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, r := range response.Records {
+		if r.Type == "TXT" && r.Name == name {
+			values = append(values, r.Value)
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/libdns/libdns"
+	"strings"
+)
+
+// Records lists TXT records of a zone, only records the user is allowed to manage are returned.
+func (s *Server) Records(ctx *gin.Context) {
+	user := s.users[ctx.MustGet(gin.AuthUserKey).(string)]
+	zone := strings.TrimSuffix(ctx.Query("zone"), ".")
+	if zone == "" {
+		abortWithError(ctx, ErrBadRequest, "query parameter zone is required")
+		return
+	}
+
+	provider := s.config.findProvider(zone)
+	if provider == nil {
+		abortWithError(ctx, ErrNotFound, fmt.Sprintf("no provider for zone %s", zone))
+		return
+	}
+	var allowed []*SubZone
+	for _, subZone := range user.AllowedZones {
+		if subZone.provider.Load() == provider {
+			allowed = append(allowed, subZone)
+		}
+	}
+	if len(allowed) == 0 {
+		abortWithError(ctx, ErrForbiddenZone, fmt.Sprintf("zone %s not allowed", zone))
+		return
+	}
+
+	records, err := provider.provider.GetRecords(ctx, provider.zone)
+	if err != nil {
+		abortWithError(ctx, ErrProvider, fmt.Sprintf("error getting records of %s: %s", provider, err))
+		return
+	}
+
+	var visible []libdns.Record
+	for _, record := range records {
+		if record.Type != "TXT" {
+			continue
+		}
+		record.Name = provider.fqdn(record.Name)
+		if record.Name != zone && !strings.HasSuffix(record.Name, "."+zone) {
+			continue
+		}
+		for _, subZone := range allowed {
+			if subZone.Match(record.Name) {
+				visible = append(visible, record)
+				break
+			}
+		}
+	}
+	respondRecords(ctx, visible)
+}
+
+// findProvider returns the provider with the longest zone containing the given zone.
+func (c *Config) findProvider(zone string) *Provider {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var found *Provider
+	for z, provider := range c.providerZoneMap {
+		if zone != z && !strings.HasSuffix(zone, "."+z) {
+			continue
+		}
+		if found == nil || len(z) > len(found.zone) {
+			found = provider
+		}
+	}
+	return found
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRecordsScopedToUser(t *testing.T) {
+	router := newTestServer(t, `
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+  - zone: example.org
+    provider: memory
+    config: {}
+users:
+  - name: alice
+    token: alice123
+    allowedZones:
+      - zone: foo.example.com
+  - name: bob
+    token: bob123
+    allowedZones:
+      - zone: bar.example.com
+      - zone: bar.example.org
+`).Router()
+
+	for _, present := range []struct{ user, token, fqdn string }{
+		{"alice", "alice123", "_acme-challenge.foo.example.com"},
+		{"bob", "bob123", "_acme-challenge.bar.example.com"},
+		{"bob", "bob123", "_acme-challenge.bar.example.org"},
+	} {
+		status, body := serve(t, router, http.MethodPost, "/v1/present", present.user, present.token,
+			`{"fqdn":"`+present.fqdn+`","value":"challenge-value"}`)
+		if status != http.StatusOK {
+			t.Fatalf("present %s: %d %s", present.fqdn, status, body)
+		}
+	}
+
+	for _, tt := range []struct {
+		zone   string
+		status int
+		names  []string
+	}{
+		// bob's records in the shared zone are not listed
+		{"example.com", http.StatusOK, []string{"_acme-challenge.foo.example.com"}},
+		{"foo.example.com", http.StatusOK, []string{"_acme-challenge.foo.example.com"}},
+		{"bar.example.com", http.StatusOK, nil},
+		// alice has no zone of the provider of example.org
+		{"example.org", http.StatusForbidden, nil},
+		{"bar.example.org", http.StatusForbidden, nil},
+	} {
+		status, body := serve(t, router, http.MethodGet, "/v1/records?zone="+tt.zone, "alice", "alice123", "")
+		if status != tt.status {
+			t.Errorf("%s: expected status %d, got %d %s", tt.zone, tt.status, status, body)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		var response RecordsResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range response.Records {
+			names = append(names, r.Name)
+		}
+		if len(names) != len(tt.names) || (len(names) > 0 && names[0] != tt.names[0]) {
+			t.Errorf("%s: expected %v, got %v", tt.zone, tt.names, names)
+		}
+	}
+}
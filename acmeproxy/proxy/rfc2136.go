@@ -0,0 +1,307 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	mdns "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"hash"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRFC2136Listen    = ":53"
+	defaultTSIGAlgorithm    = mdns.HmacSHA256
+	rfc2136UpdateTimeout    = time.Minute
+	rfc2136TSIGFudgeSeconds = 300
+)
+
+type RFC2136Config struct {
+	// Enabled accepts DNS UPDATE messages, e.g. from nsupdate or cert-manager's rfc2136 solver
+	Enabled bool `yaml:"enabled"`
+	// Listen is the UDP and TCP address, default :53, it must differ from authoritative.listen
+	Listen string `yaml:"listen"`
+	// Keys are TSIG keys, each one signs updates of a user
+	Keys []*TSIGKey `yaml:"keys"`
+}
+
+type TSIGKey struct {
+	// Name of the key, e.g. example-key., compared case-insensitively
+	Name string `yaml:"name"`
+	// Algorithm of the key, default hmac-sha256
+	Algorithm string `yaml:"algorithm"`
+	// Secret is base64 encoded
+	Secret string `yaml:"secret"`
+	// User whose allowedZones apply to updates signed by this key
+	User string `yaml:"user"`
+}
+
+// rfc2136Server translates DNS UPDATE of TXT records into present and cleanup,
+// authenticated with TSIG and authorized like the http api.
+type rfc2136Server struct {
+	server *Server
+	listen string
+	keys   map[string]*TSIGKey
+}
+
+func newRFC2136Server(s *Server, config *RFC2136Config) (*rfc2136Server, error) {
+	keys := make(map[string]*TSIGKey)
+	for _, key := range config.Keys {
+		if key.Name == "" || key.Secret == "" {
+			return nil, errors.New("name and secret of rfc2136 key are required")
+		}
+		if _, err := base64.StdEncoding.DecodeString(key.Secret); err != nil {
+			return nil, errors.Wrapf(err, "secret of rfc2136 key %q is not base64 encoded", key.Name)
+		}
+		if _, ok := s.users[key.User]; !ok {
+			return nil, errors.Errorf("user %q of rfc2136 key %q not found", key.User, key.Name)
+		}
+		key.Name = mdns.CanonicalName(key.Name)
+		key.Algorithm = mdns.CanonicalName(key.Algorithm)
+		if key.Algorithm == "." {
+			key.Algorithm = defaultTSIGAlgorithm
+		}
+		keys[key.Name] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("rfc2136.keys is required")
+	}
+
+	listen := config.Listen
+	if listen == "" {
+		listen = defaultRFC2136Listen
+	}
+	return &rfc2136Server{server: s, listen: listen, keys: keys}, nil
+}
+
+// start listens on UDP and TCP and serves in background
+func (r *rfc2136Server) start() error {
+	packetConn, listener, addr, err := listenDNS(r.listen)
+	if err != nil {
+		return err
+	}
+	r.listen = addr
+
+	provider := tsigProvider(r.keys)
+	for _, server := range []*mdns.Server{
+		{PacketConn: packetConn, Handler: r, TsigProvider: provider, MsgAcceptFunc: acceptUpdate},
+		{Listener: listener, Handler: r, TsigProvider: provider, MsgAcceptFunc: acceptUpdate},
+	} {
+		go func() {
+			if err := server.ActivateAndServe(); err != nil {
+				logrus.Errorf("rfc2136 server stopped: %s", err)
+			}
+		}()
+	}
+	logrus.Infof("accepting dns updates on %s", r.listen)
+	return nil
+}
+
+// sameListenAddress checks if servers listening on a and b would use the same port,
+// an empty or unspecified host, e.g. :53 or 0.0.0.0:53, listens on every address.
+func sameListenAddress(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	if portA != portB || portA == "0" {
+		// port 0 picks a free port
+		return false
+	}
+	anyHost := func(host string) bool {
+		ip := net.ParseIP(host)
+		return host == "" || (ip != nil && ip.IsUnspecified())
+	}
+	return hostA == hostB || anyHost(hostA) || anyHost(hostB)
+}
+
+// acceptUpdate accepts UPDATE messages only, which the default accept func rejects
+func acceptUpdate(dh mdns.Header) mdns.MsgAcceptAction {
+	if dh.Bits&(1<<15) != 0 {
+		// a response
+		return mdns.MsgIgnore
+	}
+	if int(dh.Bits>>11)&0xF != mdns.OpcodeUpdate {
+		return mdns.MsgRejectNotImplemented
+	}
+	if dh.Qdcount != 1 {
+		return mdns.MsgReject
+	}
+	return mdns.MsgAccept
+}
+
+func (r *rfc2136Server) ServeDNS(w mdns.ResponseWriter, req *mdns.Msg) {
+	resp := new(mdns.Msg)
+	resp.SetReply(req)
+	key := r.verify(w, req)
+	if key == nil {
+		// an unverified request gets an unsigned response
+		resp.Rcode = mdns.RcodeNotAuth
+		_ = w.WriteMsg(resp)
+		return
+	}
+	resp.Rcode = r.update(req, key)
+	tsig := req.IsTsig()
+	resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, rfc2136TSIGFudgeSeconds, time.Now().Unix())
+	_ = w.WriteMsg(resp)
+}
+
+// tsigProvider signs and verifies with keys by their canonical name, as key names are case-insensitive,
+// TsigSecret of miekg/dns looks up the name exactly as written in the message.
+type tsigProvider map[string]*TSIGKey
+
+func (p tsigProvider) Generate(msg []byte, t *mdns.TSIG) ([]byte, error) {
+	key, ok := p[mdns.CanonicalName(t.Hdr.Name)]
+	if !ok {
+		return nil, mdns.ErrSecret
+	}
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	var h func() hash.Hash
+	switch mdns.CanonicalName(t.Algorithm) {
+	case mdns.HmacSHA1:
+		h = sha1.New
+	case mdns.HmacSHA224:
+		h = sha256.New224
+	case mdns.HmacSHA256:
+		h = sha256.New
+	case mdns.HmacSHA384:
+		h = sha512.New384
+	case mdns.HmacSHA512:
+		h = sha512.New
+	default:
+		return nil, mdns.ErrKeyAlg
+	}
+	mac := hmac.New(h, secret)
+	mac.Write(msg)
+	return mac.Sum(nil), nil
+}
+
+func (p tsigProvider) Verify(msg []byte, t *mdns.TSIG) error {
+	expected, err := p.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return mdns.ErrSig
+	}
+	return nil
+}
+
+// verify returns the key which signed the request, nil if unsigned or the signature is invalid.
+func (r *rfc2136Server) verify(w mdns.ResponseWriter, req *mdns.Msg) *TSIGKey {
+	tsig := req.IsTsig()
+	if tsig == nil {
+		logrus.Warnf("rfc2136: refused unsigned update from %s", w.RemoteAddr())
+		return nil
+	}
+	key, ok := r.keys[mdns.CanonicalName(tsig.Hdr.Name)]
+	if !ok || w.TsigStatus() != nil || mdns.CanonicalName(tsig.Algorithm) != key.Algorithm {
+		logrus.Warnf("rfc2136: tsig of key %q from %s failed: %v", tsig.Hdr.Name, w.RemoteAddr(), w.TsigStatus())
+		return nil
+	}
+	return key
+}
+
+// update applies the update section and returns the rcode.
+// Names are authorized before any change, so a refused update changes nothing,
+// a provider failure may leave earlier records of the same message applied.
+func (r *rfc2136Server) update(req *mdns.Msg, key *TSIGKey) int {
+	if len(req.Answer) > 0 {
+		// prerequisites are not supported
+		return mdns.RcodeNotImplemented
+	}
+
+	zone := mdns.CanonicalName(req.Question[0].Name)
+	ctx, cancel := context.WithTimeout(context.Background(), rfc2136UpdateTimeout)
+	defer cancel()
+
+	type change struct {
+		act     *action
+		present bool
+		// all deletes every TXT record of the name
+		all bool
+	}
+	var changes []change
+	for _, rr := range req.Ns {
+		header := rr.Header()
+		name := mdns.CanonicalName(header.Name)
+		if !mdns.IsSubDomain(zone, name) {
+			return mdns.RcodeNotZone
+		}
+		// class ANY deletes the RRset of the type, or all RRsets of the name with type ANY,
+		// e.g. RemoveRRset and RemoveName of miekg/dns, only TXT records are managed here
+		all := header.Class == mdns.ClassANY && (header.Rrtype == mdns.TypeTXT || header.Rrtype == mdns.TypeANY)
+		var value string
+		if !all {
+			txt, ok := rr.(*mdns.TXT)
+			if !ok || (header.Class != mdns.ClassINET && header.Class != mdns.ClassNONE) {
+				// only adding and deleting TXT records is supported
+				return mdns.RcodeRefused
+			}
+			value = strings.Join(txt.Txt, "")
+		}
+
+		act, err := r.server.authorize(ctx, key.User, name, value)
+		if err != nil {
+			logrus.Warnf("rfc2136: update of %q by user %q refused: %s", name, key.User, err)
+			return mdns.RcodeRefused
+		}
+		changes = append(changes, change{act: act, present: header.Class == mdns.ClassINET, all: all})
+	}
+
+	for _, c := range changes {
+		var err error
+		switch {
+		case c.present:
+			_, err = c.act.provider.Present(ctx, *c.act.request)
+		case c.all:
+			err = cleanUpAll(ctx, c.act)
+		default:
+			_, err = c.act.provider.CleanUp(ctx, *c.act.request)
+			if errors.Is(err, ErrRecordNotFound) {
+				// deleting a record which does not exist is not an error
+				err = nil
+			}
+		}
+		if err != nil {
+			logrus.Errorf("rfc2136: update of %q failed: %s", c.act.request.Name, err)
+			return mdns.RcodeServerFailure
+		}
+	}
+	return mdns.RcodeSuccess
+}
+
+// cleanUpAll cleans up every TXT record of the name of act
+func cleanUpAll(ctx context.Context, act *action) error {
+	records, err := act.provider.provider.GetRecords(ctx, act.provider.zone)
+	if err != nil {
+		return errors.Wrapf(err, "%q could not get records", act.provider)
+	}
+	for _, r := range records {
+		if r.Type != "TXT" || !strings.EqualFold(act.provider.fqdn(r.Name), act.request.Name) {
+			continue
+		}
+		record := *act.request
+		record.Value = r.Value
+		if _, err := act.provider.CleanUp(ctx, record); err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	mdns "github.com/miekg/dns"
+	"slices"
+	"testing"
+	"time"
+)
+
+const (
+	// key names are case-insensitive, the config has test-key
+	rfc2136TestKey    = "Test-Key."
+	rfc2136TestSecret = "c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+func TestRFC2136(t *testing.T) {
+	server := newTestServer(t, `
+rfc2136:
+  enabled: true
+  listen: 127.0.0.1:0
+  keys:
+    - name: test-key
+      secret: `+rfc2136TestSecret+`
+      user: alice
+providers:
+  - zone: example.com
+    provider: memory
+    config: {}
+users:
+  - name: alice
+    token: alice123
+    allowedZones:
+      - zone: foo.example.com
+`)
+	if err := server.rfc2136.start(); err != nil {
+		t.Fatal(err)
+	}
+	router := server.Router()
+	addr := server.rfc2136.listen
+	const name = "_acme-challenge.foo.example.com."
+
+	txtRR := func(name, value string) mdns.RR {
+		return &mdns.TXT{Hdr: mdns.RR_Header{Name: name, Rrtype: mdns.TypeTXT, Class: mdns.ClassINET, Ttl: 60}, Txt: []string{value}}
+	}
+	sendAs := func(key, secret string, update func(m *mdns.Msg)) int {
+		t.Helper()
+		msg := new(mdns.Msg)
+		msg.SetUpdate("example.com.")
+		update(msg)
+		msg.SetTsig(key, mdns.HmacSHA256, 300, time.Now().Unix())
+		// the client verifies the signed response
+		client := &mdns.Client{Net: "tcp", TsigSecret: map[string]string{key: secret}}
+		resp, _, err := client.Exchange(msg, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Rcode
+	}
+	send := func(secret string, update func(m *mdns.Msg)) int {
+		t.Helper()
+		return sendAs(rfc2136TestKey, secret, update)
+	}
+	values := func() []string {
+		return txtValues(t, router, "alice", "alice123", "foo.example.com", "_acme-challenge.foo.example.com")
+	}
+
+	steps := []struct {
+		step   string
+		secret string
+		update func(m *mdns.Msg)
+		rcode  int
+		values []string
+	}{
+		{"insert", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Insert([]mdns.RR{txtRR(name, "a"), txtRR(name, "b"), txtRR(name, "c")})
+		}, mdns.RcodeSuccess, []string{"a", "b", "c"}},
+		{"remove", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Remove([]mdns.RR{txtRR(name, "a")})
+		}, mdns.RcodeSuccess, []string{"b", "c"}},
+		{"remove missing", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Remove([]mdns.RR{txtRR(name, "a")})
+		}, mdns.RcodeSuccess, []string{"b", "c"}},
+		{"bad tsig", "d3Jvbmcgc2VjcmV0", func(m *mdns.Msg) {
+			m.Insert([]mdns.RR{txtRR(name, "d")})
+		}, mdns.RcodeNotAuth, []string{"b", "c"}},
+		{"outside allowed zones", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Insert([]mdns.RR{txtRR(name, "d"), txtRR("_acme-challenge.bar.example.com.", "d")})
+		}, mdns.RcodeRefused, []string{"b", "c"}},
+		{"outside zone of the update", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Insert([]mdns.RR{txtRR("_acme-challenge.foo.example.org.", "d")})
+		}, mdns.RcodeNotZone, []string{"b", "c"}},
+		{"other type", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Insert([]mdns.RR{&mdns.A{Hdr: mdns.RR_Header{Name: name, Rrtype: mdns.TypeA, Class: mdns.ClassINET}}})
+		}, mdns.RcodeRefused, []string{"b", "c"}},
+		{"remove rrset", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.RemoveRRset([]mdns.RR{txtRR(name, "")})
+		}, mdns.RcodeSuccess, nil},
+		{"insert again", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.Insert([]mdns.RR{txtRR(name, "e"), txtRR(name, "f")})
+		}, mdns.RcodeSuccess, []string{"e", "f"}},
+		{"remove name", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.RemoveName([]mdns.RR{txtRR(name, "")})
+		}, mdns.RcodeSuccess, nil},
+		{"remove rrset outside allowed zones", rfc2136TestSecret, func(m *mdns.Msg) {
+			m.RemoveRRset([]mdns.RR{txtRR("_acme-challenge.bar.example.com.", "")})
+		}, mdns.RcodeRefused, nil},
+	}
+	for _, s := range steps {
+		if rcode := send(s.secret, s.update); rcode != s.rcode {
+			t.Fatalf("%s: expected %s, got %s", s.step, mdns.RcodeToString[s.rcode], mdns.RcodeToString[rcode])
+		}
+		if got := values(); !slices.Equal(got, s.values) {
+			t.Fatalf("%s: expected %v, got %v", s.step, s.values, got)
+		}
+	}
+
+	// signed with another spelling of the key name
+	rcode := sendAs("TEST-KEY.", rfc2136TestSecret, func(m *mdns.Msg) {
+		m.Insert([]mdns.RR{txtRR(name, "g")})
+	})
+	if rcode != mdns.RcodeSuccess || !slices.Equal(values(), []string{"g"}) {
+		t.Errorf("upper case key name: expected the record inserted, got %s %v", mdns.RcodeToString[rcode], values())
+	}
+	if rcode := sendAs("other-key.", rfc2136TestSecret, func(m *mdns.Msg) {
+		m.Insert([]mdns.RR{txtRR(name, "h")})
+	}); rcode != mdns.RcodeNotAuth {
+		t.Errorf("unknown key: expected %s, got %s", mdns.RcodeToString[mdns.RcodeNotAuth], mdns.RcodeToString[rcode])
+	}
+}
@@ -1,21 +1,77 @@
 package proxy
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/libdns/libdns"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 type Server struct {
-	users  map[string]*User
-	config *Config
+	users   map[string]*User
+	config  *Config
+	cname   *cnameResolver
+	checker *providerChecker
+	// authoritative serves zones of the authoritative provider, nil if there is none
+	authoritative *authoritativeServer
+	// acmeDNS serves the acme-dns api, nil if disabled
+	acmeDNS *acmeDNS
+	// rfc2136 accepts dns updates, nil if disabled
+	rfc2136 *rfc2136Server
+	// ready is set once the listener is up
+	ready atomic.Bool
+	// stop cancels background work like the refresh of discovered zones
+	stop context.CancelFunc
 }
 
+var (
+	ErrDomainNotAllowed = errors.New("domain not allowed")
+	ErrCNAME            = errors.New("unable to follow cname")
+)
+
+// Request is either the default format of lego's httpreq with fqdn and value,
+// or its RAW format with domain, token and keyAuth, from which the record is computed as ACME does.
 type Request struct {
-	FQDN  string `json:"fqdn" binding:"required"`
-	Value string `json:"value" binding:"required"`
+	FQDN  string `json:"fqdn"`
+	Value string `json:"value"`
+
+	Domain  string `json:"domain"`
+	Token   string `json:"token"`
+	KeyAuth string `json:"keyAuth"`
+}
+
+// normalize validates the request, and fills FQDN and Value from the RAW format.
+func (r *Request) normalize() error {
+	switch {
+	case r.FQDN != "" || r.Value != "":
+		if r.FQDN == "" || r.Value == "" {
+			return errors.New("fqdn and value are required")
+		}
+	case r.Domain != "" || r.KeyAuth != "":
+		if r.Domain == "" || r.KeyAuth == "" {
+			return errors.New("domain and keyAuth are required")
+		}
+		// the key authorization is token.thumbprint
+		if r.Token != "" && !strings.HasPrefix(r.KeyAuth, r.Token+".") {
+			return errors.New("keyAuth does not match token")
+		}
+		domain := strings.TrimSuffix(strings.TrimPrefix(r.Domain, "*."), ".")
+		r.FQDN = "_acme-challenge." + domain + "."
+		digest := sha256.Sum256([]byte(r.KeyAuth))
+		r.Value = base64.RawURLEncoding.EncodeToString(digest[:])
+	default:
+		return errors.New("either fqdn and value, or domain and keyAuth are required")
+	}
+	return nil
 }
 
 type action struct {
@@ -31,16 +87,10 @@ func (s *Server) Present(ctx *gin.Context) {
 
 	records, err := act.provider.Present(ctx, *act.request)
 	if err != nil {
-		ctx.JSON(400, gin.H{
-			"message": fmt.Sprintf("error appending record %s: %s", act.request.Name, err),
-			"success": false,
-		})
+		abortWithError(ctx, ErrProvider, fmt.Sprintf("error appending record %s: %s", act.request.Name, err))
 		return
 	}
-	ctx.JSON(200, gin.H{
-		"records": records,
-		"success": true,
-	})
+	respondRecords(ctx, records)
 }
 
 func (s *Server) CleanUp(ctx *gin.Context) {
@@ -49,61 +99,111 @@ func (s *Server) CleanUp(ctx *gin.Context) {
 		return
 	}
 	records, err := act.provider.CleanUp(ctx, *act.request)
+	if errors.Is(err, ErrRecordNotFound) {
+		abortWithError(ctx, ErrNotFound, fmt.Sprintf("error cleaning up record %s: %s", act.request.Name, err))
+		return
+	}
 	if err != nil {
-		ctx.AbortWithStatusJSON(400, gin.H{
-			"message": fmt.Sprintf("error cleaning up record %s: %s", act.request.Name, err),
-			"success": false,
-		})
+		abortWithError(ctx, ErrProvider, fmt.Sprintf("error cleaning up record %s: %s", act.request.Name, err))
 		return
 	}
-	ctx.JSON(200, gin.H{
-		"records": records,
-		"success": true,
-	})
+	respondRecords(ctx, records)
 }
 
 func (s *Server) common(ctx *gin.Context) (*action, error) {
 	user := ctx.MustGet(gin.AuthUserKey).(string)
 	var request Request
-	err := ctx.BindJSON(&request)
+	err := ctx.ShouldBindJSON(&request)
 	if err != nil {
-		ctx.AbortWithStatusJSON(400, gin.H{
-			"message": "bad request, unable to bind json",
-		})
+		abortWithError(ctx, ErrBadRequest, fmt.Sprintf("bad request, unable to bind json: %s", err))
 		return nil, err
 	}
+	err = request.normalize()
+	if err != nil {
+		abortWithError(ctx, ErrBadRequest, fmt.Sprintf("bad request, %s", err))
+		return nil, err
+	}
+
+	act, err := s.authorize(ctx, user, request.FQDN, request.Value)
+	if errors.Is(err, ErrCNAME) {
+		abortWithError(ctx, ErrResolve, err.Error())
+		return nil, err
+	}
+	if err != nil {
+		abortWithError(ctx, ErrForbiddenZone, err.Error())
+		return nil, err
+	}
+	return act, nil
+}
 
+// authorize finds the provider for the user's fqdn, following its cname if allowed.
+func (s *Server) authorize(ctx context.Context, username, fqdn, value string) (*action, error) {
 	// check allowed zones
 	// cert-manager may add a . to the end
-	request.FQDN = strings.TrimSuffix(request.FQDN, ".")
-	zone := s.findTargetZone(user, &request)
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	if s.cname != nil && s.users[username].FollowCNAME {
+		target, err := s.cname.resolve(ctx, fqdn)
+		if err != nil {
+			return nil, errors.Wrapf(ErrCNAME, "%s: %s", fqdn, err)
+		}
+		if target != fqdn {
+			logrus.Infof("following cname %q -> %q", fqdn, target)
+			fqdn = target
+		}
+	}
+	zone := s.findTargetZone(username, fqdn)
 	if zone == nil {
-		ctx.AbortWithStatusJSON(403, gin.H{
-			"message": "domain not allowed",
-			"success": false,
-		})
-		return nil, fmt.Errorf("domain not allowed")
+		return nil, errors.Wrapf(ErrDomainNotAllowed, "%s", fqdn)
+	}
+	provider := zone.provider.Load()
+	if provider == nil {
+		// unbound by a refresh of discovered zones since findTargetZone
+		return nil, errors.Wrapf(ErrDomainNotAllowed, "%s", fqdn)
 	}
 
 	return &action{
-		provider: zone.provider,
+		provider: provider,
 		request: &libdns.Record{
 			Type:  "TXT",
-			Name:  request.FQDN,
-			Value: request.Value,
+			Name:  fqdn,
+			Value: value,
 		},
 	}, nil
 }
 
-// findTargetZone finds the target zone for the given user and request.
+// Authenticate checks the token of a user.
+func (s *Server) Authenticate(username, token string) bool {
+	user, ok := s.users[username]
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(user.Token)) == 1
+}
+
+// PresentRecord authorizes the user and presents a TXT record, for frontends other than the http api.
+func (s *Server) PresentRecord(ctx context.Context, username, fqdn, value string) ([]libdns.Record, error) {
+	act, err := s.authorize(ctx, username, fqdn, value)
+	if err != nil {
+		return nil, err
+	}
+	return act.provider.Present(ctx, *act.request)
+}
+
+// CleanUpRecord authorizes the user and cleans up a TXT record, for frontends other than the http api.
+func (s *Server) CleanUpRecord(ctx context.Context, username, fqdn, value string) ([]libdns.Record, error) {
+	act, err := s.authorize(ctx, username, fqdn, value)
+	if err != nil {
+		return nil, err
+	}
+	return act.provider.CleanUp(ctx, *act.request)
+}
+
+// findTargetZone finds the target zone for the given user and fqdn.
 //
 // It iterates over the allowed zones for the given user and checks if the
-// request's FQDN matches any of them.
-// The first matched zone is returned.
-func (s *Server) findTargetZone(username string, request *Request) *SubZone {
+// fqdn matches any of them.
+// The first matched zone with a provider is returned.
+func (s *Server) findTargetZone(username string, fqdn string) *SubZone {
 	user := s.users[username]
 	for _, zone := range user.AllowedZones {
-		if zone.Match(request.FQDN) {
+		if zone.Match(fqdn) && zone.provider.Load() != nil {
 			return zone
 		}
 	}
@@ -116,18 +216,72 @@ func NewServer() *Server {
 	return config.CreateServer()
 }
 
-func (s *Server) Serve() {
-	accounts := make(map[string]string)
-	for _, user := range s.users {
-		accounts[user.Name] = user.Token
+// Close stops background work of the server.
+func (s *Server) Close() {
+	if s.stop != nil {
+		s.stop()
 	}
+}
+
+func (s *Server) Router() *gin.Engine {
 	router := gin.Default()
-	router.POST("/present", gin.BasicAuth(accounts), s.Present)
-	router.POST("/cleanup", gin.BasicAuth(accounts), s.CleanUp)
+	router.NoRoute(func(ctx *gin.Context) {
+		abortWithError(ctx, ErrNotFound, fmt.Sprintf("no route for %s %s", ctx.Request.Method, ctx.Request.URL.Path))
+	})
+
+	router.GET("/healthz", s.Healthz)
+	router.GET("/readyz", s.Readyz)
+	if s.checker != nil {
+		router.GET("/healthz/providers", s.ProvidersHealth)
+	}
+
+	v1 := router.Group("/v1")
+	v1.GET("/openapi.yaml", serveOpenAPI)
+	v1.POST("/present", s.basicAuth, s.Present)
+	v1.POST("/cleanup", s.basicAuth, s.CleanUp)
+	v1.GET("/records", s.basicAuth, s.Records)
+	v1.GET("/providers", s.basicAuth, s.Providers)
+	v1.GET("/providers/:name/schema", s.ProviderSchema)
 
-	err := router.Run(s.config.Server)
+	// unversioned aliases of v1, kept for existing clients
+	router.POST("/present", s.basicAuth, legacyResponse, s.Present)
+	router.POST("/cleanup", s.basicAuth, legacyResponse, s.CleanUp)
+
+	if s.acmeDNS != nil {
+		s.acmeDNS.routes(router)
+	}
+	return router
+}
+
+func (s *Server) Serve() {
+	addr := s.config.Server
+	if addr == "" {
+		addr = ":8080"
+	}
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		logrus.Errorf("Failed to start server at: %s", s.config.Server)
 		panic(err)
 	}
+
+	if s.authoritative != nil {
+		if err := s.authoritative.start(); err != nil {
+			panic(err)
+		}
+	}
+	if s.rfc2136 != nil {
+		if err := s.rfc2136.start(); err != nil {
+			panic(err)
+		}
+	}
+
+	logrus.Infof("listening on %s", listener.Addr())
+	s.ready.Store(true)
+	err = http.Serve(listener, s.Router())
+	s.ready.Store(false)
+	s.Close()
+	if err != nil {
+		logrus.Errorf("Server at %s stopped", s.config.Server)
+		panic(err)
+	}
 }
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestRequestNormalize(t *testing.T) {
+	// the token and the JWK thumbprint are the examples of RFC 8555 and RFC 7638,
+	// digests are computed independently with: printf %s "$keyAuth" | openssl dgst -sha256 -binary | basenc --base64url | tr -d =
+	const rfcKeyAuth = "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ-PCt92wr-oA.NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	const rfcValue = "ZTRx1Ckl1-tM05o5zaizTTA0yUy5AGereMgSNWC6Ll8"
+
+	tests := []struct {
+		name    string
+		request Request
+		fqdn    string
+		value   string
+		wantErr string
+	}{
+		{
+			name:    "default format",
+			request: Request{FQDN: "_acme-challenge.example.com.", Value: "challenge-value"},
+			fqdn:    "_acme-challenge.example.com.",
+			value:   "challenge-value",
+		},
+		{
+			name:    "default format wins",
+			request: Request{FQDN: "_acme-challenge.example.com.", Value: "challenge-value", Domain: "example.org", KeyAuth: rfcKeyAuth},
+			fqdn:    "_acme-challenge.example.com.",
+			value:   "challenge-value",
+		},
+		{
+			name:    "raw",
+			request: Request{Domain: "example.com", KeyAuth: rfcKeyAuth},
+			fqdn:    "_acme-challenge.example.com.",
+			value:   rfcValue,
+		},
+		{
+			name:    "raw with token",
+			request: Request{Domain: "example.com", Token: "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ-PCt92wr-oA", KeyAuth: rfcKeyAuth},
+			fqdn:    "_acme-challenge.example.com.",
+			value:   rfcValue,
+		},
+		{
+			name:    "raw short key authorization",
+			request: Request{Domain: "example.com", KeyAuth: "123d=="},
+			fqdn:    "_acme-challenge.example.com.",
+			value:   "ADw2sEd82DUgXcQ9hNBZThJs7zVJkR5v9JeSbAb9mZY",
+		},
+		{
+			name:    "raw wildcard",
+			request: Request{Domain: "*.example.com", KeyAuth: rfcKeyAuth},
+			fqdn:    "_acme-challenge.example.com.",
+			value:   rfcValue,
+		},
+		{
+			name:    "raw fqdn",
+			request: Request{Domain: "www.example.com.", KeyAuth: rfcKeyAuth},
+			fqdn:    "_acme-challenge.www.example.com.",
+			value:   rfcValue,
+		},
+		{name: "fqdn only", request: Request{FQDN: "_acme-challenge.example.com."}, wantErr: "fqdn and value are required"},
+		{name: "value only", request: Request{Value: "challenge-value"}, wantErr: "fqdn and value are required"},
+		{name: "domain only", request: Request{Domain: "example.com"}, wantErr: "domain and keyAuth are required"},
+		{name: "key authorization only", request: Request{KeyAuth: rfcKeyAuth}, wantErr: "domain and keyAuth are required"},
+		{name: "token mismatch", request: Request{Domain: "example.com", Token: "other", KeyAuth: rfcKeyAuth}, wantErr: "keyAuth does not match token"},
+		{name: "token only", request: Request{Token: "token"}, wantErr: "either fqdn and value, or domain and keyAuth are required"},
+		{name: "empty", wantErr: "either fqdn and value, or domain and keyAuth are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+			err := request.normalize()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if request.FQDN != tt.fqdn || request.Value != tt.value {
+				t.Errorf("expected %s %s, got %s %s", tt.fqdn, tt.value, request.FQDN, request.Value)
+			}
+		})
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"github.com/pkg/errors"
 	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 type User struct {
 	Name         string     `yaml:"name"`
 	Token        string     `yaml:"token"`
 	AllowedZones []*SubZone `yaml:"allowedZones"`
+	// FollowCNAME allows the requested fqdn to be resolved to its cname target,
+	// the target is then matched against AllowedZones instead
+	FollowCNAME bool `yaml:"followCNAME"`
 }
 
 type SubZone struct {
@@ -18,7 +22,7 @@ type SubZone struct {
 	Regex string `yaml:"regex"`
 
 	regex    *regexp.Regexp
-	provider *Provider
+	provider atomic.Pointer[Provider]
 }
 
 func (s *SubZone) Match(domain string) bool {
@@ -53,30 +57,58 @@ func (u *User) init(providerZoneMap map[string]*Provider) error {
 			return errors.Wrap(err, "failed to initialize sub-rawZone")
 		}
 
-		// find provider for this sub-zone
-		if zone.regex != nil {
-			if provider, ok := providerZoneMap[zone.Zone]; ok {
-				zone.provider = provider
-			} else {
-				return fmt.Errorf("unable to find provider for regex sub-rawZone %q", zone.Zone)
-			}
-		} else {
-			for z, provider := range providerZoneMap {
-				if zone.Zone == z || strings.HasSuffix(zone.Zone, "."+z) {
-					if zone.provider != nil {
-						return fmt.Errorf("zone have multiple provider match: %q and %q", zone.provider, provider)
-					} else {
-						zone.provider = provider
-					}
-				}
-			}
-			if zone.provider == nil {
-				return fmt.Errorf("unable to find provider for zone %q", zone.Zone)
-			}
-		}
-
 		subZones = append(subZones, zone)
 	}
 	u.AllowedZones = subZones
-	return nil
+	return u.bind(providerZoneMap)
+}
+
+// bind finds the provider for each sub-zone,
+// it is called again whenever discovered zones change.
+// A sub-zone without a matching provider is unbound, so it is not allowed until its zone is back.
+func (u *User) bind(providerZoneMap map[string]*Provider) (err error) {
+	for _, zone := range u.AllowedZones {
+		provider, findErr := zone.findProvider(providerZoneMap)
+		if findErr != nil && err == nil {
+			err = findErr
+		}
+		zone.provider.Store(provider)
+	}
+	return err
+}
+
+// providers returns the providers bound to the user's allowed zones, each once.
+func (u *User) providers() []*Provider {
+	var providers []*Provider
+	seen := make(map[*Provider]bool)
+	for _, zone := range u.AllowedZones {
+		provider := zone.provider.Load()
+		if provider == nil || seen[provider] {
+			continue
+		}
+		seen[provider] = true
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+func (s *SubZone) findProvider(providerZoneMap map[string]*Provider) (*Provider, error) {
+	if s.regex != nil {
+		if provider, ok := providerZoneMap[s.Zone]; ok {
+			return provider, nil
+		}
+		return nil, fmt.Errorf("unable to find provider for regex sub-rawZone %q", s.Zone)
+	}
+
+	// the longest zone wins, e.g. sub.example.com over example.com
+	var found *Provider
+	for z, provider := range providerZoneMap {
+		if (s.Zone == z || strings.HasSuffix(s.Zone, "."+z)) && (found == nil || len(z) > len(found.zone)) {
+			found = provider
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unable to find provider for zone %q", s.Zone)
+	}
+	return found, nil
 }